@@ -3,14 +3,21 @@ package main
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/events"
+	"github.com/rj-2006/techtalk/internal/game"
 	"github.com/rj-2006/techtalk/internal/handlers"
+	"github.com/rj-2006/techtalk/internal/mail"
 	"github.com/rj-2006/techtalk/internal/middleware"
+	"github.com/rj-2006/techtalk/internal/oidc"
+	"github.com/rj-2006/techtalk/internal/ratelimit"
 	"github.com/rj-2006/techtalk/internal/websocket"
 )
 
@@ -33,9 +40,128 @@ func main() {
 		log.Fatal("Migration failed: ", err)
 	}
 
-	handlers.ChatHub = websocket.NewHub()
+	if err := handlers.SeedRoles(); err != nil {
+		log.Fatal("Failed to seed roles: ", err)
+	}
+
+	if err := handlers.LoadRevokedSessions(); err != nil {
+		log.Fatal("Failed to load revoked sessions: ", err)
+	}
+
+	// HUB_BACKEND=postgres shares chat broadcasts and presence between
+	// replicas; the default keeps everything in this process.
+	switch os.Getenv("HUB_BACKEND") {
+	case "postgres":
+		handlers.ChatHub = websocket.NewHubWithBackend(websocket.NewPostgresBackend(database.DB, database.DSN))
+		handlers.Events = events.NewPostgresBus(database.DB, database.DSN)
+	case "", "memory":
+		handlers.ChatHub = websocket.NewHub()
+	default:
+		log.Fatal("Unknown HUB_BACKEND: ", os.Getenv("HUB_BACKEND"))
+	}
+	handlers.ChatHub.OnUserOffline = handlers.RecordLastSeen
+	handlers.SubscribeEvents()
+	handlers.Events.Start()
+
+	// HUB_SLOW_CONSUMER picks what happens to clients that fall behind:
+	// disconnect (default), drop_oldest or coalesce_typing.
+	if raw := os.Getenv("HUB_SLOW_CONSUMER"); raw != "" {
+		policy, ok := websocket.ParseSlowConsumerPolicy(raw)
+		if !ok {
+			log.Fatal("Unknown HUB_SLOW_CONSUMER: ", raw)
+		}
+		handlers.ChatHub.SlowConsumer = policy
+	}
 	go handlers.ChatHub.Run()
 
+	// Game snapshots are superseded every tick, so falling behind drops the
+	// oldest rather than disconnecting.
+	handlers.GameHub = websocket.NewHub()
+	handlers.GameHub.SlowConsumer = websocket.PolicyDropOldest
+	go handlers.GameHub.Run()
+
+	handlers.GameServer = game.NewManager()
+	handlers.GameServer.Checkpoint = handlers.SaveGameCheckpoint
+	handlers.GameServer.OnFinish = handlers.FinishGame
+	handlers.GameServer.Replay = handlers.SaveReplayEvents
+	// GAME_SPECTATOR_DELAY (e.g. "10s") holds back what spectators see.
+	if raw := os.Getenv("GAME_SPECTATOR_DELAY"); raw != "" {
+		delay, err := time.ParseDuration(raw)
+		if err != nil || delay < 0 {
+			log.Fatal("Invalid GAME_SPECTATOR_DELAY: ", raw)
+		}
+		handlers.GameServer.SpectatorDelay = delay
+	}
+	if err := handlers.ResumeGames(); err != nil {
+		log.Fatal("Failed to resume games: ", err)
+	}
+
+	// RATE_LIMIT_BACKEND=postgres shares login throttling between replicas;
+	// the default keeps counters in this process.
+	switch os.Getenv("RATE_LIMIT_BACKEND") {
+	case "postgres":
+		handlers.UseRateLimitStore(ratelimit.NewDBStore(database.DB))
+	case "", "memory":
+	default:
+		log.Fatal("Unknown RATE_LIMIT_BACKEND: ", os.Getenv("RATE_LIMIT_BACKEND"))
+	}
+
+	// MAIL_BACKEND=smtp sends through SMTP_HOST; otherwise mail is written
+	// to MAIL_OUTBOX_DIR for local development.
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "TechTalk <no-reply@localhost>"
+	}
+	switch os.Getenv("MAIL_BACKEND") {
+	case "smtp":
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			port = 587
+		}
+		handlers.Mailer = &mail.SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     mailFrom,
+		}
+	case "", "outbox":
+		dir := os.Getenv("MAIL_OUTBOX_DIR")
+		if dir == "" {
+			dir = "./outbox"
+		}
+		handlers.Mailer = &mail.OutboxMailer{Dir: dir, From: mailFrom}
+	default:
+		log.Fatal("Unknown MAIL_BACKEND: ", os.Getenv("MAIL_BACKEND"))
+	}
+	if appURL := os.Getenv("APP_URL"); appURL != "" {
+		handlers.AppURL = appURL
+	}
+	// REQUIRE_EMAIL_VERIFICATION=true keeps unverified accounts from posting
+	// and chatting. They can still sign in, read and resend the email.
+	if required, err := strconv.ParseBool(os.Getenv("REQUIRE_EMAIL_VERIFICATION")); err == nil {
+		middleware.EmailVerificationRequired = required
+	}
+
+	middleware.LookupPersonalToken = handlers.LookupPersonalToken
+
+	// Single sign-on is on when OIDC_ISSUER is set. Any issuer that serves
+	// discovery works, including a local mock over plain http.
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		clientID := os.Getenv("OIDC_CLIENT_ID")
+		redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+		if clientID == "" || redirectURL == "" {
+			log.Fatal("OIDC_ISSUER needs OIDC_CLIENT_ID and OIDC_REDIRECT_URL")
+		}
+		handlers.OIDC = oidc.NewProvider(oidc.Config{
+			Issuer:       issuer,
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  redirectURL,
+			Scopes:       strings.Fields(os.Getenv("OIDC_SCOPES")),
+		})
+	}
+
 	r := gin.Default()
 
 	// CORS Middleware
@@ -48,7 +174,7 @@ func main() {
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -56,36 +182,122 @@ func main() {
 	// Public routes
 	r.POST("/api/register", handlers.Register)
 	r.POST("/api/login", handlers.Login)
+	r.POST("/api/login/2fa", handlers.VerifyLoginChallenge)
+	r.GET("/api/auth/oidc/login", handlers.OIDCLogin)
+	r.GET("/api/auth/oidc/callback", handlers.OIDCCallback)
+	r.POST("/api/refresh", handlers.RefreshToken)
+	r.POST("/api/email/verify", handlers.VerifyEmail)
+	r.POST("/api/password/forgot", handlers.ForgotPassword)
+	r.POST("/api/password/reset", handlers.ResetPassword)
 
 	// Protected routes
+	// Account routes stay open to users who still have to enroll in a 2FA
+	// their role requires.
+	account := r.Group("/api")
+	account.Use(middleware.AuthMiddleware())
+	{
+		// Sessions
+		account.POST("/logout", handlers.Logout)
+		account.GET("/sessions", handlers.GetSessions)
+		account.DELETE("/sessions/:id", handlers.RevokeSession)
+		account.POST("/email/verify/resend", handlers.ResendVerification)
+
+		// Two-factor authentication
+		account.POST("/2fa/setup", handlers.SetupTOTP)
+		account.POST("/2fa/enable", handlers.EnableTOTP)
+		account.POST("/2fa/disable", handlers.DisableTOTP)
+		account.POST("/2fa/recovery-codes", handlers.RegenerateRecoveryCodes)
+	}
+
 	protected := r.Group("/api")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(), middleware.Require2FA())
 	{
+		// Routes that publish content also need a verified email, when
+		// REQUIRE_EMAIL_VERIFICATION is on.
+		verified := middleware.RequireVerifiedEmail()
+
 		// Forum
-		protected.POST("/threads", handlers.CreateThread)
+		protected.POST("/threads", verified, handlers.CreateThread)
 		protected.GET("/threads", handlers.GetThreads)
 		protected.GET("/threads/:id", handlers.GetThread)
-		protected.POST("/threads/:id/posts", handlers.CreatePost)
+		protected.PATCH("/threads/:id", handlers.UpdateThread)
+		protected.DELETE("/threads/:id", handlers.DeleteThread)
+		protected.POST("/threads/:id/posts", verified, handlers.CreatePost)
+		protected.PATCH("/threads/:id/posts/:postId", handlers.UpdatePost)
+		protected.DELETE("/threads/:id/posts/:postId", handlers.DeletePost)
+		protected.GET("/threads/:id/posts/:postId/revisions", handlers.GetPostRevisions)
 
 		// Thread Reactions
 		protected.POST("/threads/:id/reactions", handlers.AddThreadReactions)
 		protected.DELETE("/threads/:id/reactions/:emoji", handlers.RemoveThreadReaction)
 		protected.GET("/threads/:id/reactions", handlers.GetThreadReactions)
 
+		// Search
+		protected.GET("/search", handlers.Search)
+
 		// Chat
-		protected.POST("/chatrooms", handlers.CreateChatroom)
+		protected.POST("/chatrooms", verified, handlers.CreateChatroom)
 		protected.GET("/chatrooms", handlers.GetChatrooms)
 		protected.GET("/chatrooms/:id/history", handlers.GetChatHistory)
-		protected.GET("/chatrooms/:id/ws", handlers.HandleChatWebsocket)
+		protected.GET("/chatrooms/:id/ws", verified, handlers.HandleChatWebsocket)
+		protected.POST("/chatrooms/:id/join", handlers.JoinChatroom)
+		protected.POST("/chatrooms/:id/leave", handlers.LeaveChatroom)
+		protected.POST("/chatrooms/:id/invites", handlers.CreateChatroomInvite)
+		protected.GET("/chatrooms/:id/invites", handlers.GetChatroomInvites)
+		protected.DELETE("/chatrooms/:id/invites/:inviteId", handlers.RevokeChatroomInvite)
+		protected.POST("/invites/:code/accept", handlers.AcceptChatroomInvite)
+		protected.POST("/chatrooms/:id/read", handlers.MarkChatroomRead)
+		protected.GET("/chatrooms/:id/members", handlers.GetChatroomMembers)
+		protected.GET("/presence", handlers.GetPresence)
+
+		// Direct Messages
+		protected.POST("/dms", verified, handlers.OpenDM)
+		protected.GET("/dms", handlers.GetDMs)
+
+		// Message Reactions
+		protected.GET("/chatrooms/:id/messages/:msgId/reactions", handlers.GetMessageReactions)
+		protected.POST("/chatrooms/:id/messages/:msgId/reactions", handlers.AddMessageReaction)
+		protected.DELETE("/chatrooms/:id/messages/:msgId/reactions/:emoji", handlers.RemoveMessageReaction)
+
+		// Game Lobby
+		protected.POST("/games", handlers.CreateGameRoom)
+		protected.GET("/games", handlers.GetGameRooms)
+		protected.GET("/games/types", handlers.GetGameTypes)
+		protected.GET("/games/:id", handlers.GetGameRoom)
+		protected.POST("/games/:id/join", handlers.JoinGameRoom)
+		protected.POST("/games/:id/leave", handlers.LeaveGameRoom)
+		protected.POST("/games/:id/ready", handlers.SetGameReady)
+		protected.GET("/games/:id/ws", handlers.HandleGameWebsocket)
+		protected.GET("/games/:id/replay", handlers.GetGameReplay)
+		protected.GET("/leaderboards/:gameType", handlers.GetLeaderboard)
+		protected.GET("/users/:id/matches", handlers.GetUserMatches)
+
+		// Personal access tokens and bots
+		protected.POST("/tokens", handlers.CreatePersonalToken)
+		protected.GET("/tokens", handlers.GetPersonalTokens)
+		protected.DELETE("/tokens/:id", handlers.RevokePersonalToken)
+		protected.POST("/bots", middleware.RequirePermission(middleware.PermBotsManage), handlers.CreateBot)
+		protected.GET("/bots", handlers.GetBots)
 
 		// Upload
 		protected.POST("/upload/avatar", handlers.UploadAvatar)
 		protected.POST("/upload/image", handlers.UploadThreadImage)
 
 		// Custom Emojis
-		protected.POST("/emojis", handlers.CreateCustomEmoji)
+		protected.POST("/emojis", middleware.RequirePermission(middleware.PermEmojiManage), handlers.CreateCustomEmoji)
 		protected.GET("/emojis", handlers.GetCustomEmojis)
-		protected.DELETE("/emojis/:id", handlers.DeleteCustomEmoji)
+		protected.DELETE("/emojis/:id", middleware.RequirePermission(middleware.PermEmojiManage), handlers.DeleteCustomEmoji)
+
+		// Roles
+		admin := protected.Group("")
+		admin.Use(middleware.RequirePermission(middleware.PermRolesManage))
+		{
+			admin.GET("/roles", handlers.GetRoles)
+			admin.POST("/roles", handlers.CreateRole)
+			admin.PATCH("/roles/:id", handlers.UpdateRole)
+			admin.DELETE("/roles/:id", handlers.DeleteRole)
+			admin.PUT("/users/:id/roles", handlers.SetUserRoles)
+		}
 	}
 
 	// Serve static files
@@ -2,11 +2,11 @@ import * as React from 'react'
 import { Link } from 'react-router-dom'
 import { cn } from '../../lib/utils'
 import { formatDistanceToNow } from 'date-fns'
-import type { Thread } from '../../types/api'
+import type { ThreadSummary } from '../../types/api'
 import { ReactionButton } from './reaction-button'
 
 interface ThreadCardProps {
-  thread: Thread
+  thread: ThreadSummary
   onAddReaction: (emoji: string) => void
   onRemoveReaction: (emoji: string) => void
   isAuthenticated: boolean
@@ -24,7 +24,16 @@ export function ThreadCard({
 }: ThreadCardProps) {
   const reactions = React.useMemo(() => {
     const reactionMap = new Map<string, { emoji: string; count: number; hasReacted: boolean }>()
-    
+
+    // Listed threads only carry per-emoji counts.
+    if (!thread.reactions && thread.reaction_counts) {
+      return Object.entries(thread.reaction_counts).map(([emoji, count]) => ({
+        emoji,
+        count,
+        hasReacted: false,
+      }))
+    }
+
     thread.reactions?.forEach((reaction) => {
       const existing = reactionMap.get(reaction.emoji)
       if (existing) {
@@ -42,9 +51,9 @@ export function ThreadCard({
     })
     
     return Array.from(reactionMap.values())
-  }, [currentUserId, thread.reactions])
+  }, [currentUserId, thread.reactions, thread.reaction_counts])
 
-  const postCount = thread.posts?.length || 0
+  const postCount = thread.post_count ?? thread.posts?.length ?? 0
   const imageCount = thread.images?.length || 0
 
   return (
@@ -1,7 +1,8 @@
-import { useMutation, useQuery, useQueryClient } from '@tanstack/react-query'
+import { useMemo } from 'react'
+import { useInfiniteQuery, useMutation, useQuery, useQueryClient } from '@tanstack/react-query'
 import { api } from '../lib/api-client'
 import { queryKeys } from '../lib/query-provider'
-import type { Chatroom, ChatMessage } from '../types/api'
+import type { Chatroom, ChatHistoryResponse, ChatMessage } from '../types/api'
 
 export function useChatrooms() {
   return useQuery({
@@ -10,18 +11,29 @@ export function useChatrooms() {
   })
 }
 
-export function useChatHistory(chatroomId: number, params?: { page?: number; limit?: number }) {
-  return useQuery({
+// useChatHistory loads a room's messages newest first, one cursor page at a
+// time; fetchNextPage walks further back. messages is in chronological order.
+export function useChatHistory(chatroomId: number, params?: { limit?: number }) {
+  const query = useInfiniteQuery({
     queryKey: queryKeys.chatrooms.messages(chatroomId),
-    queryFn: () => {
+    queryFn: ({ pageParam }) => {
       const searchParams = new URLSearchParams()
-      if (params?.page) searchParams.set('page', String(params.page))
+      if (pageParam) searchParams.set('before', String(pageParam))
       if (params?.limit) searchParams.set('limit', String(params.limit))
       const query = searchParams.toString()
-      return api.get<ChatMessage[]>(`/api/chatrooms/${chatroomId}/history${query ? `?${query}` : ''}`)
+      return api.get<ChatHistoryResponse>(`/api/chatrooms/${chatroomId}/history${query ? `?${query}` : ''}`)
     },
+    initialPageParam: undefined as number | undefined,
+    getNextPageParam: (lastPage) => (lastPage.has_more ? lastPage.next_cursor ?? undefined : undefined),
     enabled: !!chatroomId,
   })
+
+  const messages = useMemo<ChatMessage[] | undefined>(
+    () => query.data?.pages.flatMap((page) => page.messages).reverse(),
+    [query.data],
+  )
+
+  return { ...query, messages }
 }
 
 export function useCreateChatroom() {
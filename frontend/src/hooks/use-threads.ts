@@ -6,6 +6,7 @@ export function useThreads(params?: {
   page?: number
   limit?: number
   search?: string
+  sort?: 'newest' | 'activity' | 'replies' | 'reactions'
 }) {
   return useQuery({
     queryKey: queryKeys.threads.list(params),
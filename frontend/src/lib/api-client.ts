@@ -1,10 +1,14 @@
 import { useAuthStore } from '../stores/auth-store'
-import type { ApiError } from '../types/api'
+import type { ApiError, RefreshResponse } from '../types/api'
 
 const BASE_URL = import.meta.env.VITE_API_URL || 'http://localhost:5070'
 
 class ApiClient {
   private baseUrl: string
+  // Shared so that concurrent 401s trigger a single refresh; the server
+  // rotates the refresh token, so a second refresh with the old one would
+  // be treated as reuse and kill the session.
+  private refreshing: Promise<boolean> | null = null
 
   constructor(baseUrl: string) {
     this.baseUrl = baseUrl
@@ -15,6 +19,54 @@ class ApiClient {
     return useAuthStore.getState().token
   }
 
+  private refreshSession(): Promise<boolean> {
+    if (!this.refreshing) {
+      this.refreshing = (async () => {
+        const refreshToken = useAuthStore.getState().refreshToken
+        if (!refreshToken) return false
+
+        try {
+          const response = await fetch(`${this.baseUrl}/api/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refreshToken }),
+          })
+          if (!response.ok) return false
+
+          const data: RefreshResponse = await response.json()
+          useAuthStore.getState().setTokens(data.token, data.refresh_token)
+          return true
+        } catch {
+          return false
+        }
+      })().finally(() => {
+        this.refreshing = null
+      })
+    }
+    return this.refreshing
+  }
+
+  // request sends an API call; an authenticated call that gets a 401 is
+  // retried once after refreshing the access token.
+  private async request<T>(
+    endpoint: string,
+    init: RequestInit,
+    includeAuth: boolean,
+    json: boolean = true
+  ): Promise<T> {
+    const send = () =>
+      fetch(`${this.baseUrl}${endpoint}`, {
+        ...init,
+        headers: this.createHeaders(includeAuth, json),
+      })
+
+    let response = await send()
+    if (response.status === 401 && includeAuth && (await this.refreshSession())) {
+      response = await send()
+    }
+    return this.handleResponse<T>(response)
+  }
+
   private async handleResponse<T>(response: Response): Promise<T> {
     if (!response.ok) {
       const error: ApiError = {
@@ -52,9 +104,10 @@ class ApiClient {
     return response.text() as Promise<T>
   }
 
-  private createHeaders(includeAuth: boolean = true): HeadersInit {
-    const headers: HeadersInit = {
-      'Content-Type': 'application/json',
+  private createHeaders(includeAuth: boolean = true, json: boolean = true): HeadersInit {
+    const headers: HeadersInit = {}
+    if (json) {
+      headers['Content-Type'] = 'application/json'
     }
 
     if (includeAuth) {
@@ -68,46 +121,35 @@ class ApiClient {
   }
 
   async get<T>(endpoint: string, includeAuth: boolean = true): Promise<T> {
-    const response = await fetch(`${this.baseUrl}${endpoint}`, {
-      method: 'GET',
-      headers: this.createHeaders(includeAuth),
-    })
-    return this.handleResponse<T>(response)
+    return this.request<T>(endpoint, { method: 'GET' }, includeAuth)
   }
 
   async post<T>(endpoint: string, data?: unknown, includeAuth: boolean = true): Promise<T> {
-    const response = await fetch(`${this.baseUrl}${endpoint}`, {
-      method: 'POST',
-      headers: this.createHeaders(includeAuth),
-      body: data ? JSON.stringify(data) : undefined,
-    })
-    return this.handleResponse<T>(response)
+    return this.request<T>(
+      endpoint,
+      { method: 'POST', body: data ? JSON.stringify(data) : undefined },
+      includeAuth
+    )
   }
 
   async put<T>(endpoint: string, data?: unknown, includeAuth: boolean = true): Promise<T> {
-    const response = await fetch(`${this.baseUrl}${endpoint}`, {
-      method: 'PUT',
-      headers: this.createHeaders(includeAuth),
-      body: data ? JSON.stringify(data) : undefined,
-    })
-    return this.handleResponse<T>(response)
+    return this.request<T>(
+      endpoint,
+      { method: 'PUT', body: data ? JSON.stringify(data) : undefined },
+      includeAuth
+    )
   }
 
   async patch<T>(endpoint: string, data?: unknown, includeAuth: boolean = true): Promise<T> {
-    const response = await fetch(`${this.baseUrl}${endpoint}`, {
-      method: 'PATCH',
-      headers: this.createHeaders(includeAuth),
-      body: data ? JSON.stringify(data) : undefined,
-    })
-    return this.handleResponse<T>(response)
+    return this.request<T>(
+      endpoint,
+      { method: 'PATCH', body: data ? JSON.stringify(data) : undefined },
+      includeAuth
+    )
   }
 
   async delete<T>(endpoint: string, includeAuth: boolean = true): Promise<T> {
-    const response = await fetch(`${this.baseUrl}${endpoint}`, {
-      method: 'DELETE',
-      headers: this.createHeaders(includeAuth),
-    })
-    return this.handleResponse<T>(response)
+    return this.request<T>(endpoint, { method: 'DELETE' }, includeAuth)
   }
 
   async postForm<T>(
@@ -115,20 +157,7 @@ class ApiClient {
     formData: FormData,
     includeAuth: boolean = true
   ): Promise<T> {
-    const headers: HeadersInit = {}
-    if (includeAuth) {
-      const token = this.getToken()
-      if (token) {
-        headers['Authorization'] = `Bearer ${token}`
-      }
-    }
-
-    const response = await fetch(`${this.baseUrl}${endpoint}`, {
-      method: 'POST',
-      headers,
-      body: formData,
-    })
-    return this.handleResponse<T>(response)
+    return this.request<T>(endpoint, { method: 'POST', body: formData }, includeAuth, false)
   }
 
   async upload<T>(
@@ -139,21 +168,7 @@ class ApiClient {
   ): Promise<T> {
     const formData = new FormData()
     formData.append(fieldName, file)
-
-    const headers: HeadersInit = {}
-    if (includeAuth) {
-      const token = this.getToken()
-      if (token) {
-        headers['Authorization'] = `Bearer ${token}`
-      }
-    }
-
-    const response = await fetch(`${this.baseUrl}${endpoint}`, {
-      method: 'POST',
-      headers,
-      body: formData,
-    })
-    return this.handleResponse<T>(response)
+    return this.postForm<T>(endpoint, formData, includeAuth)
   }
 }
 
@@ -19,7 +19,13 @@ export function ChatPage() {
   const typingTimeoutsRef = useRef<Record<string, number>>({})
   
   const { data: chatrooms, isLoading: chatroomsLoading } = useChatrooms()
-  const { data: history, isLoading: historyLoading } = useChatHistory(chatroomId || 0)
+  const {
+    messages: history,
+    isLoading: historyLoading,
+    hasNextPage: hasOlderMessages,
+    fetchNextPage: fetchOlderMessages,
+    isFetchingNextPage: loadingOlderMessages,
+  } = useChatHistory(chatroomId || 0)
   const createChatroom = useCreateChatroom()
   
   const userId = useAuthStore((state) => state.user?.id)
@@ -63,9 +69,15 @@ export function ChatPage() {
   })
 
   useEffect(() => {
-    if (history && Array.isArray(history)) {
-      setMessages(history)
-    }
+    if (!history) return
+    // Keep live messages that arrived while older pages were loading.
+    setMessages((prev) => {
+      const byId = new Map<number, ChatMessage>()
+      for (const message of [...history, ...prev]) {
+        byId.set(message.id, message)
+      }
+      return [...byId.values()].sort((a, b) => a.id - b.id)
+    })
   }, [history])
 
   useEffect(() => {
@@ -151,11 +163,25 @@ export function ChatPage() {
                 <div className="text-muted-foreground">Loading messages...</div>
               </div>
             ) : (
-              <MessageList
-                messages={messages}
-                currentUserId={userId}
-                className="flex-1"
-              />
+              <>
+                {hasOlderMessages && (
+                  <div className="flex justify-center border-b py-2">
+                    <button
+                      type="button"
+                      onClick={() => fetchOlderMessages()}
+                      disabled={loadingOlderMessages}
+                      className="text-xs text-muted-foreground hover:text-foreground disabled:opacity-50"
+                    >
+                      {loadingOlderMessages ? 'Loading...' : 'Load earlier messages'}
+                    </button>
+                  </div>
+                )}
+                <MessageList
+                  messages={messages}
+                  currentUserId={userId}
+                  className="flex-1"
+                />
+              </>
             )}
 
             {/* Typing Indicator */}
@@ -15,6 +15,7 @@ export function ThreadListPage() {
   const [createError, setCreateError] = useState<string | null>(null)
   
   const { data, isLoading, error } = useThreads({ search })
+  const threads = data?.threads
   const createThread = useCreateThread()
   const addReaction = useAddReaction()
   const removeReaction = useRemoveReaction()
@@ -80,9 +81,9 @@ export function ThreadListPage() {
             title="Failed to load threads"
             description="Something went wrong. Please try again."
           />
-        ) : data && data.length > 0 ? (
+        ) : threads && threads.length > 0 ? (
           <div className="space-y-4">
-            {data.map((thread) => (
+            {threads.map((thread) => (
               <ThreadCard
                 key={thread.id}
                 thread={thread}
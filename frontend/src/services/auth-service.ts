@@ -6,7 +6,7 @@ export const authService = {
   async login(credentials: LoginRequest): Promise<AuthResponse> {
     const response = await api.post<AuthResponse>('/api/login', credentials, false)
     
-    useAuthStore.getState().login(response.user, response.token)
+    useAuthStore.getState().login(response.user, response.token, response.refresh_token)
     
     return response
   },
@@ -14,7 +14,7 @@ export const authService = {
   async register(data: RegisterRequest): Promise<AuthResponse> {
     const response = await api.post<AuthResponse>('/api/register', data, false)
     
-    useAuthStore.getState().login(response.user, response.token)
+    useAuthStore.getState().login(response.user, response.token, response.refresh_token)
     
     return response
   },
@@ -1,19 +1,21 @@
 import { api } from '../lib/api-client'
-import type { Thread, Post, ThreadReaction, ChatMessage, CustomEmoji, Chatroom } from '../types/api'
+import type { Thread, ThreadListResponse, Post, ThreadReaction, ChatHistoryResponse, CustomEmoji, Chatroom } from '../types/api'
 
 export const threadService = {
   async getThreads(params?: {
     page?: number
     limit?: number
     search?: string
-  }): Promise<Thread[]> {
+    sort?: 'newest' | 'activity' | 'replies' | 'reactions'
+  }): Promise<ThreadListResponse> {
     const searchParams = new URLSearchParams()
     if (params?.page) searchParams.set('page', String(params.page))
     if (params?.limit) searchParams.set('limit', String(params.limit))
     if (params?.search) searchParams.set('search', params.search)
-    
+    if (params?.sort) searchParams.set('sort', params.sort)
+
     const query = searchParams.toString()
-    return api.get<Thread[]>(`/api/threads${query ? `?${query}` : ''}`)
+    return api.get<ThreadListResponse>(`/api/threads${query ? `?${query}` : ''}`)
   },
 
   async getThread(id: number): Promise<Thread> {
@@ -73,11 +75,11 @@ export const chatService = {
   },
 
   async getChatHistory(chatroomId: number, params?: {
-    page?: number
+    before?: number
     limit?: number
-  }): Promise<ChatMessage[]> {
+  }): Promise<ChatHistoryResponse> {
     const searchParams = new URLSearchParams()
-    if (params?.page) searchParams.set('page', String(params.page))
+    if (params?.before) searchParams.set('before', String(params.before))
     if (params?.limit) searchParams.set('limit', String(params.limit))
     
     const query = searchParams.toString()
@@ -5,12 +5,14 @@ import type { User } from '../types/api'
 interface AuthState {
   user: User | null
   token: string | null
+  refreshToken: string | null
   isAuthenticated: boolean
   isLoading: boolean
   setUser: (user: User | null) => void
   setToken: (token: string | null) => void
+  setTokens: (token: string, refreshToken: string) => void
   setLoading: (loading: boolean) => void
-  login: (user: User, token: string) => void
+  login: (user: User, token: string, refreshToken: string) => void
   logout: () => void
 }
 
@@ -19,6 +21,7 @@ export const useAuthStore = create<AuthState>()(
     (set) => ({
       user: null,
       token: null,
+      refreshToken: null,
       isAuthenticated: false,
       isLoading: false,
 
@@ -28,13 +31,17 @@ export const useAuthStore = create<AuthState>()(
       setToken: (token) =>
         set({ token }),
 
+      setTokens: (token, refreshToken) =>
+        set({ token, refreshToken }),
+
       setLoading: (isLoading) =>
         set({ isLoading }),
 
-      login: (user, token) =>
+      login: (user, token, refreshToken) =>
         set({
           user,
           token,
+          refreshToken,
           isAuthenticated: true,
           isLoading: false,
         }),
@@ -43,6 +50,7 @@ export const useAuthStore = create<AuthState>()(
         set({
           user: null,
           token: null,
+          refreshToken: null,
           isAuthenticated: false,
           isLoading: false,
         }),
@@ -52,6 +60,7 @@ export const useAuthStore = create<AuthState>()(
       partialize: (state) => ({
         user: state.user,
         token: state.token,
+        refreshToken: state.refreshToken,
         isAuthenticated: state.isAuthenticated,
       }),
     }
@@ -24,9 +24,17 @@ export interface RegisterRequest {
 
 export interface AuthResponse {
   token: string
+  refresh_token: string
+  expires_in: number
   user: User
 }
 
+export interface RefreshResponse {
+  token: string
+  refresh_token: string
+  expires_in: number
+}
+
 export interface Thread {
   id: number
   title: string
@@ -39,6 +47,25 @@ export interface Thread {
   updated_at: string
 }
 
+// ThreadSummary is a thread as listed by GET /api/threads: counts and the
+// latest activity instead of posts and individual reactions.
+export interface ThreadSummary extends Thread {
+  post_count?: number
+  reaction_count?: number
+  reaction_counts?: Record<string, number>
+  last_post_at?: string | null
+  last_post_user?: User
+  last_activity_at?: string
+}
+
+export interface ThreadListResponse {
+  threads: ThreadSummary[]
+  page: number
+  limit: number
+  total: number
+  has_more: boolean
+}
+
 export interface Post {
   id: number
   content: string
@@ -84,6 +111,12 @@ export interface ChatMessage {
   reactions: MessageReaction[]
 }
 
+export interface ChatHistoryResponse {
+  messages: ChatMessage[]
+  next_cursor: number | null
+  has_more: boolean
+}
+
 export interface MessageReaction {
   id: number
   message_id: number
@@ -11,9 +11,14 @@ import (
 
 var DB *gorm.DB
 
+// DSN is the connection string used by Connect, kept for components that need
+// their own dedicated connection (e.g. LISTEN/NOTIFY).
+var DSN string
+
 func Connect(host, user, password, dbname, port string) error {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
 		host, user, password, dbname, port)
+	DSN = dsn
 
 	var err error
 	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
@@ -31,14 +36,36 @@ func Migrate() error {
 		&models.User{},
 		&models.Thread{},
 		&models.Post{},
+		&models.PostRevision{},
 		&models.Chatroom{},
+		&models.ChatroomMember{},
+		&models.ChatroomInvite{},
 		&models.ChatMessage{},
 		&models.GameRoom{},
+		&models.GameRoomPlayer{},
 		&models.GameState{},
+		&models.ReplayEntry{},
+		&models.MatchResult{},
+		&models.MatchParticipant{},
+		&models.PlayerRating{},
 		&models.ThreadImage{},
 		&models.ThreadReaction{},
 		&models.MessageReaction{},
 		&models.CustomEmoji{},
+		&models.Session{},
+		&models.RetiredRefreshToken{},
+		&models.EmailToken{},
+		&models.RecoveryCode{},
+		&models.LoginChallenge{},
+		&models.RateLimit{},
+		&models.LoginAttempt{},
+		&models.PersonalAccessToken{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.Role{},
+		&models.Permission{},
+		&models.HubPresence{},
+		&models.HubMessage{},
 	)
 
 	if err != nil {
@@ -55,5 +82,39 @@ func Migrate() error {
 		ON message_reactions(message_id, user_id, emoji)
 	`)
 
+	DB.Exec(`
+		CREATE INDEX IF NOT EXISTS idx_chat_messages_room_cursor
+		ON chat_messages(chatroom_id, id DESC)
+	`)
+
+	DB.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_messages_client_msg
+		ON chat_messages(user_id, client_msg_id) WHERE client_msg_id IS NOT NULL
+	`)
+
+	return migrateSearch()
+}
+
+// migrateSearch adds generated tsvector columns and GIN indexes backing the
+// full-text search endpoint.
+func migrateSearch() error {
+	statements := []string{
+		`ALTER TABLE threads ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (to_tsvector('english', coalesce(title, ''))) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_threads_search ON threads USING GIN (search_vector)`,
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (to_tsvector('english', coalesce(content, ''))) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_search ON posts USING GIN (search_vector)`,
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (to_tsvector('english', coalesce(content, ''))) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_messages_search ON chat_messages USING GIN (search_vector)`,
+	}
+
+	for _, stmt := range statements {
+		if err := DB.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,154 @@
+// Package events carries small control events, such as "this session was
+// revoked", between server instances so their in-memory caches stay in step.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"gorm.io/gorm"
+)
+
+// Handler receives an event's payload. It is called with a nil payload after
+// the bus (re)connects, when events may have been missed, so it should
+// resynchronise from the database.
+type Handler func(payload []byte)
+
+// Bus publishes events to the other server instances. Publishers apply the
+// change locally themselves; a Bus never delivers an event back to the node
+// that published it.
+type Bus interface {
+	Subscribe(topic string, handler Handler)
+	Publish(topic string, payload interface{})
+	Start()
+}
+
+// MemoryBus is the single-node Bus: there is nobody else to tell.
+type MemoryBus struct{}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+func (b *MemoryBus) Subscribe(topic string, handler Handler) {}
+
+func (b *MemoryBus) Publish(topic string, payload interface{}) {}
+
+func (b *MemoryBus) Start() {}
+
+const eventsChannel = "techtalk_events"
+
+type envelope struct {
+	Node    string          `json:"n"`
+	Topic   string          `json:"t"`
+	Payload json.RawMessage `json:"p,omitempty"`
+}
+
+// PostgresBus sends events with NOTIFY on a dedicated LISTEN connection.
+type PostgresBus struct {
+	db     *gorm.DB
+	dsn    string
+	nodeID string
+
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewPostgresBus(db *gorm.DB, dsn string) *PostgresBus {
+	return &PostgresBus{
+		db:       db,
+		dsn:      dsn,
+		nodeID:   uuid.New().String(),
+		handlers: make(map[string][]Handler),
+	}
+}
+
+func (b *PostgresBus) Subscribe(topic string, handler Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[topic] = append(b.handlers[topic], handler)
+}
+
+func (b *PostgresBus) Publish(topic string, payload interface{}) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Event bus failed to encode %s: %v", topic, err)
+		return
+	}
+	message, _ := json.Marshal(envelope{Node: b.nodeID, Topic: topic, Payload: data})
+	if err := b.db.Exec("SELECT pg_notify(?, ?)", eventsChannel, string(message)).Error; err != nil {
+		log.Printf("Event bus failed to publish %s: %v", topic, err)
+	}
+}
+
+// Start listens in the background, reconnecting with backoff.
+func (b *PostgresBus) Start() {
+	go func() {
+		backoff := time.Second
+		for {
+			err := b.listen()
+			log.Printf("Event bus listener stopped: %v (retrying in %s)", err, backoff)
+			time.Sleep(backoff)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+		}
+	}()
+}
+
+func (b *PostgresBus) dispatch(topic string, payload []byte) {
+	b.mu.RLock()
+	handlers := b.handlers[topic]
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+}
+
+func (b *PostgresBus) listen() error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+eventsChannel); err != nil {
+		return err
+	}
+
+	// Anything published while we weren't listening is lost; have every
+	// subscriber resync.
+	b.mu.RLock()
+	topics := make([]string, 0, len(b.handlers))
+	for topic := range b.handlers {
+		topics = append(topics, topic)
+	}
+	b.mu.RUnlock()
+	for _, topic := range topics {
+		b.dispatch(topic, nil)
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event envelope
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Printf("Event bus received invalid payload: %v", err)
+			continue
+		}
+		if event.Node == b.nodeID {
+			continue
+		}
+		b.dispatch(event.Topic, event.Payload)
+	}
+}
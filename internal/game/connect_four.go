@@ -0,0 +1,214 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const GameTypeConnectFour = "connect_four"
+
+const (
+	ConnectFourRows    = 6
+	ConnectFourColumns = 7
+
+	// A player who lets their turn clock run out forfeits.
+	ConnectFourTurnTime = 60 * time.Second
+
+	connectFourTickRate = 4
+)
+
+var (
+	ErrNotYourTurn = errors.New("it is not your turn")
+	ErrColumnFull  = errors.New("that column is full")
+	ErrBadColumn   = errors.New("column must be between 0 and 6")
+	ErrGameOver    = errors.New("the game is over")
+)
+
+func init() {
+	Register(Definition{
+		GameType:   GameTypeConnectFour,
+		Name:       "Connect Four",
+		MinPlayers: 2,
+		MaxPlayers: 2,
+		TickRate:   connectFourTickRate,
+		TurnBased:  true,
+		New:        func() GameEngine { return &ConnectFour{} },
+	})
+}
+
+// ConnectFourMove is the payload of a connect_four game_move frame.
+type ConnectFourMove struct {
+	Column int `json:"column"`
+}
+
+// ConnectFour is a two-player turn-based engine. Board cells hold 0 when
+// empty, otherwise the seat (1 or 2) of the player whose disc is there; row 0
+// is the bottom.
+type ConnectFour struct {
+	Players   [2]uint                                  `json:"players"`
+	Board     [ConnectFourRows][ConnectFourColumns]int `json:"board"`
+	Turn      int                                      `json:"turn"` // index into Players
+	Moves     int                                      `json:"moves"`
+	TurnTicks int                                      `json:"turn_ticks"`
+	Winner    uint                                     `json:"winner,omitempty"`
+	Draw      bool                                     `json:"draw,omitempty"`
+	Forfeit   bool                                     `json:"forfeit,omitempty"`
+	LastMove  *ConnectFourMove                         `json:"last_move,omitempty"`
+
+	dirty bool
+}
+
+// ConnectFourState is what clients see.
+type ConnectFourState struct {
+	ConnectFour
+	CurrentPlayer uint    `json:"current_player,omitempty"`
+	TurnRemaining float64 `json:"turn_remaining"` // seconds
+}
+
+func (g *ConnectFour) Init(players []uint) error {
+	if len(players) != 2 {
+		return errors.New("connect four needs exactly two players")
+	}
+	*g = ConnectFour{Players: [2]uint{players[0], players[1]}, dirty: true}
+	return nil
+}
+
+func (g *ConnectFour) Restore(state []byte) error {
+	if err := json.Unmarshal(state, g); err != nil {
+		return err
+	}
+	g.dirty = true
+	return nil
+}
+
+func (g *ConnectFour) Serialize() ([]byte, error) {
+	return json.Marshal(g)
+}
+
+func (g *ConnectFour) ApplyMove(playerID uint, raw json.RawMessage) error {
+	if g.Finished() {
+		return ErrGameOver
+	}
+	if playerID != g.Players[0] && playerID != g.Players[1] {
+		return ErrUnknownPlayer
+	}
+	if playerID != g.Players[g.Turn] {
+		return ErrNotYourTurn
+	}
+
+	var move ConnectFourMove
+	if err := json.Unmarshal(raw, &move); err != nil {
+		return errors.New("invalid move payload")
+	}
+	if move.Column < 0 || move.Column >= ConnectFourColumns {
+		return ErrBadColumn
+	}
+
+	row := -1
+	for r := 0; r < ConnectFourRows; r++ {
+		if g.Board[r][move.Column] == 0 {
+			row = r
+			break
+		}
+	}
+	if row < 0 {
+		return ErrColumnFull
+	}
+
+	seat := g.Turn + 1
+	g.Board[row][move.Column] = seat
+	g.Moves++
+	g.LastMove = &move
+	g.TurnTicks = 0
+	g.dirty = true
+
+	switch {
+	case g.connectsFour(row, move.Column, seat):
+		g.Winner = playerID
+	case g.Moves == ConnectFourRows*ConnectFourColumns:
+		g.Draw = true
+	default:
+		g.Turn = 1 - g.Turn
+	}
+	return nil
+}
+
+// connectsFour reports whether the disc just placed at row, col completes a
+// line of four in any direction.
+func (g *ConnectFour) connectsFour(row, col, seat int) bool {
+	directions := [][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	for _, d := range directions {
+		count := 1
+		for _, sign := range []int{1, -1} {
+			r, c := row+sign*d[0], col+sign*d[1]
+			for r >= 0 && r < ConnectFourRows && c >= 0 && c < ConnectFourColumns && g.Board[r][c] == seat {
+				count++
+				r, c = r+sign*d[0], c+sign*d[1]
+			}
+		}
+		if count >= 4 {
+			return true
+		}
+	}
+	return false
+}
+
+// Tick runs the turn clock.
+func (g *ConnectFour) Tick() {
+	if g.Finished() {
+		return
+	}
+	g.TurnTicks++
+	if time.Duration(g.TurnTicks)*(time.Second/connectFourTickRate) >= ConnectFourTurnTime {
+		g.Winner = g.Players[1-g.Turn]
+		g.Forfeit = true
+		g.dirty = true
+	}
+}
+
+func (g *ConnectFour) Finished() bool {
+	return g.Winner != 0 || g.Draw
+}
+
+func (g *ConnectFour) State() interface{} {
+	state := ConnectFourState{ConnectFour: *g}
+	if !g.Finished() {
+		state.CurrentPlayer = g.Players[g.Turn]
+		elapsed := time.Duration(g.TurnTicks) * (time.Second / connectFourTickRate)
+		state.TurnRemaining = (ConnectFourTurnTime - elapsed).Seconds()
+	}
+	return state
+}
+
+func (g *ConnectFour) Keyframe() interface{} {
+	g.dirty = false
+	return g.State()
+}
+
+// Delta sends the whole state after a move; the board is small enough that
+// diffing it is not worth it.
+func (g *ConnectFour) Delta() interface{} {
+	if !g.dirty {
+		return nil
+	}
+	g.dirty = false
+	return g.State()
+}
+
+func (g *ConnectFour) Results() []Result {
+	results := []Result{
+		{PlayerID: g.Players[0], Placement: 1},
+		{PlayerID: g.Players[1], Placement: 1},
+	}
+	for i := range results {
+		switch {
+		case g.Winner == 0:
+		case results[i].PlayerID == g.Winner:
+			results[i].Score = 1
+		default:
+			results[i].Placement = 2
+		}
+	}
+	return results
+}
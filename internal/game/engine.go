@@ -0,0 +1,112 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrUnsupportedGame = errors.New("unsupported game type")
+
+// GameEngine is the rules and state of one match. A Match drives it from a
+// single goroutine, so engines need no locking of their own.
+type GameEngine interface {
+	// Init sets up a new match for the players, in seat order.
+	Init(players []uint) error
+
+	// Restore loads a state previously returned by Serialize.
+	Restore(state []byte) error
+
+	// ApplyMove validates and applies a player's move, as sent in the
+	// payload of a game_move frame. A rejected move returns an error that is
+	// shown to the player.
+	ApplyMove(playerID uint, move json.RawMessage) error
+
+	// Tick advances the game by one tick of the definition's TickRate.
+	Tick()
+
+	Finished() bool
+
+	Serialize() ([]byte, error)
+
+	// State is the full public state, sent to clients when they join. It
+	// must not affect what Delta reports.
+	State() interface{}
+
+	// Keyframe is the full state broadcast periodically to players; the next
+	// Delta is relative to it.
+	Keyframe() interface{}
+
+	// Delta is what changed since the previous Delta or Keyframe, or nil if
+	// nothing did.
+	Delta() interface{}
+
+	// Results ranks the players once the game has finished.
+	Results() []Result
+}
+
+// Result is one player's outcome. Placement starts at 1; tied players share
+// a placement.
+type Result struct {
+	PlayerID  uint `json:"player_id"`
+	Placement int  `json:"placement"`
+	Score     int  `json:"score"`
+}
+
+// Definition describes a game type that can be hosted.
+type Definition struct {
+	GameType   string `json:"game_type"`
+	Name       string `json:"name"`
+	MinPlayers int    `json:"min_players"`
+	MaxPlayers int    `json:"max_players"`
+	TickRate   int    `json:"tick_rate"` // ticks per second
+	TurnBased  bool   `json:"turn_based"`
+
+	New func() GameEngine `json:"-"`
+}
+
+func (d Definition) TickInterval() time.Duration {
+	return time.Second / time.Duration(d.TickRate)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Definition)
+)
+
+// Register makes a game type available to the lobby and game server. Engines
+// call it from init.
+func Register(def Definition) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if def.New == nil || def.TickRate <= 0 {
+		panic("game: invalid definition for " + def.GameType)
+	}
+	if _, exists := registry[def.GameType]; exists {
+		panic("game: " + def.GameType + " registered twice")
+	}
+	registry[def.GameType] = def
+}
+
+func Lookup(gameType string) (Definition, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	def, ok := registry[gameType]
+	return def, ok
+}
+
+// Definitions lists every registered game type by name.
+func Definitions() []Definition {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	defs := make([]Definition, 0, len(registry))
+	for _, def := range registry {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].GameType < defs[j].GameType })
+	return defs
+}
@@ -0,0 +1,303 @@
+package game
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	ws "github.com/rj-2006/techtalk/internal/websocket"
+)
+
+const GameTypeSmashKarts = "smash_karts"
+
+const (
+	ArenaWidth    = 2000.0
+	ArenaHeight   = 2000.0
+	KartRadius    = 24.0
+	MaxKartSpeed  = 400.0 // units per second
+	MatchDuration = 3 * time.Minute
+
+	kartTickRate     = 20
+	kartTickInterval = time.Second / kartTickRate
+
+	// Movement checks allow for jitter between the client's clock and ours.
+	speedTolerance = 1.25
+	teleportSlack  = 20.0
+	// maxMoveTicks caps how many ticks of travel one move may cover, so a
+	// client that goes quiet can't bank distance and jump across the arena.
+	maxMoveTicks = 3
+
+	// A kart scores a smash by ramming another at smashSpeed or faster.
+	smashSpeed    = 150.0
+	smashCooldown = 2 * time.Second
+
+	// Karts nobody is steering coast to a stop.
+	coastFriction = 0.9
+)
+
+var (
+	ErrUnknownPlayer = errors.New("not a player in this match")
+	ErrTooFast       = errors.New("speed exceeds the kart limit")
+	ErrTeleport      = errors.New("moved further than possible since the last update")
+	ErrOutOfBounds   = errors.New("position is outside the arena")
+)
+
+func init() {
+	Register(Definition{
+		GameType:   GameTypeSmashKarts,
+		Name:       "Smash Karts",
+		MinPlayers: 2,
+		MaxPlayers: 16,
+		TickRate:   kartTickRate,
+		New:        func() GameEngine { return &Karts{} },
+	})
+}
+
+type Kart struct {
+	PlayerID  uint    `json:"player_id"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	VelocityX float64 `json:"velocity_x"`
+	VelocityY float64 `json:"velocity_y"`
+	Rotation  float64 `json:"rotation"`
+	Score     int     `json:"score"`
+
+	// LastMoveTick is when the player's last move was accepted.
+	LastMoveTick uint64 `json:"last_move_tick"`
+
+	// tickX and tickY are where the kart was at the end of the last tick;
+	// moves are checked against them, not against earlier moves this tick.
+	tickX, tickY float64
+}
+
+// Karts is the authoritative smash_karts engine. Players report their kart's
+// position in ws.GameMoveMessage frames; the server accepts it if it is
+// physically possible, derives the kart's velocity from how far it actually
+// moved, and scores collisions.
+type Karts struct {
+	Ticks         uint64            `json:"tick"`
+	DurationTicks uint64            `json:"duration_ticks"`
+	Karts         map[uint]*Kart    `json:"karts"`
+	LastSmash     map[string]uint64 `json:"last_smash,omitempty"`
+
+	moved    map[uint]bool
+	lastSent map[uint]Kart
+}
+
+// Init places one kart per player on a circle around the arena centre, in
+// seat order.
+func (k *Karts) Init(players []uint) error {
+	k.DurationTicks = uint64(MatchDuration / kartTickInterval)
+	k.Karts = make(map[uint]*Kart, len(players))
+	k.LastSmash = make(map[string]uint64)
+	k.reset()
+
+	radius := math.Min(ArenaWidth, ArenaHeight) / 3
+	for i, id := range players {
+		angle := 2 * math.Pi * float64(i) / float64(len(players))
+		k.Karts[id] = &Kart{
+			PlayerID: id,
+			X:        ArenaWidth/2 + radius*math.Cos(angle),
+			Y:        ArenaHeight/2 + radius*math.Sin(angle),
+			Rotation: angle + math.Pi, // facing the centre
+		}
+	}
+	k.anchor()
+	return nil
+}
+
+func (k *Karts) Restore(state []byte) error {
+	if err := json.Unmarshal(state, k); err != nil {
+		return err
+	}
+	if k.Karts == nil {
+		return errors.New("checkpoint has no karts")
+	}
+	if k.LastSmash == nil {
+		k.LastSmash = make(map[string]uint64)
+	}
+	k.reset()
+	k.anchor()
+	return nil
+}
+
+// anchor records every kart's position as of the end of the current tick.
+func (k *Karts) anchor() {
+	for _, kart := range k.Karts {
+		kart.tickX, kart.tickY = kart.X, kart.Y
+	}
+}
+
+func (k *Karts) reset() {
+	k.moved = make(map[uint]bool)
+	k.lastSent = make(map[uint]Kart)
+}
+
+func (k *Karts) Serialize() ([]byte, error) {
+	return json.Marshal(k)
+}
+
+// ApplyMove accepts a player's reported position if it is physically possible
+// given where the kart was at the end of the last tick. The reported velocity
+// is only sanity-checked; Tick derives the real one.
+func (k *Karts) ApplyMove(playerID uint, raw json.RawMessage) error {
+	kart, ok := k.Karts[playerID]
+	if !ok {
+		return ErrUnknownPlayer
+	}
+
+	var move ws.GameMoveMessage
+	if err := json.Unmarshal(raw, &move); err != nil {
+		return errors.New("invalid move payload")
+	}
+
+	if move.X < 0 || move.X > ArenaWidth || move.Y < 0 || move.Y > ArenaHeight {
+		return ErrOutOfBounds
+	}
+	if math.Hypot(move.VelocityX, move.VelocityY) > MaxKartSpeed*speedTolerance {
+		return ErrTooFast
+	}
+
+	ticks := min(max(k.Ticks-kart.LastMoveTick, 1), maxMoveTicks)
+	elapsed := (time.Duration(ticks) * kartTickInterval).Seconds()
+	if math.Hypot(move.X-kart.tickX, move.Y-kart.tickY) > MaxKartSpeed*elapsed*speedTolerance+teleportSlack {
+		return ErrTeleport
+	}
+
+	kart.X, kart.Y = move.X, move.Y
+	kart.Rotation = move.Rotation
+	kart.LastMoveTick = k.Ticks
+	k.moved[playerID] = true
+	return nil
+}
+
+// Tick sets the velocity of every kart that moved this tick from its
+// displacement, moves the rest along their last velocity, then scores
+// collisions.
+func (k *Karts) Tick() {
+	k.Ticks++
+	dt := kartTickInterval.Seconds()
+
+	for id, kart := range k.Karts {
+		if k.moved[id] {
+			kart.VelocityX = (kart.X - kart.tickX) / dt
+			kart.VelocityY = (kart.Y - kart.tickY) / dt
+			if speed := math.Hypot(kart.VelocityX, kart.VelocityY); speed > MaxKartSpeed {
+				kart.VelocityX *= MaxKartSpeed / speed
+				kart.VelocityY *= MaxKartSpeed / speed
+			}
+			continue
+		}
+		kart.X = clamp(kart.X+kart.VelocityX*dt, 0, ArenaWidth)
+		kart.Y = clamp(kart.Y+kart.VelocityY*dt, 0, ArenaHeight)
+		kart.VelocityX *= coastFriction
+		kart.VelocityY *= coastFriction
+	}
+	clear(k.moved)
+	k.anchor()
+
+	k.scoreSmashes()
+}
+
+// scoreSmashes awards a point to the faster kart of each colliding pair, once
+// per pair per smashCooldown.
+func (k *Karts) scoreSmashes() {
+	ids := k.playerIDs()
+	cooldown := uint64(smashCooldown / kartTickInterval)
+
+	for i := 0; i < len(ids); i++ {
+		for j := i + 1; j < len(ids); j++ {
+			a, b := k.Karts[ids[i]], k.Karts[ids[j]]
+			if math.Hypot(a.X-b.X, a.Y-b.Y) > 2*KartRadius {
+				continue
+			}
+
+			key := pairKey(a.PlayerID, b.PlayerID)
+			if last, ok := k.LastSmash[key]; ok && k.Ticks-last < cooldown {
+				continue
+			}
+
+			speedA := math.Hypot(a.VelocityX, a.VelocityY)
+			speedB := math.Hypot(b.VelocityX, b.VelocityY)
+			switch {
+			case speedA >= smashSpeed && speedA > speedB:
+				a.Score++
+			case speedB >= smashSpeed && speedB > speedA:
+				b.Score++
+			default:
+				continue
+			}
+			k.LastSmash[key] = k.Ticks
+		}
+	}
+}
+
+func (k *Karts) Finished() bool {
+	return k.Ticks >= k.DurationTicks
+}
+
+func (k *Karts) remaining() time.Duration {
+	if k.Finished() {
+		return 0
+	}
+	return time.Duration(k.DurationTicks-k.Ticks) * kartTickInterval
+}
+
+func (k *Karts) State() interface{} {
+	return k.fullSnapshot()
+}
+
+// Keyframe sends every field and makes it the baseline for the next Delta.
+func (k *Karts) Keyframe() interface{} {
+	return k.snapshot(k.lastSent, true)
+}
+
+func (k *Karts) Delta() interface{} {
+	snapshot := k.snapshot(k.lastSent, false)
+	if len(snapshot.Karts) == 0 {
+		return nil
+	}
+	return snapshot
+}
+
+// Results ranks karts by smashes scored.
+func (k *Karts) Results() []Result {
+	results := make([]Result, 0, len(k.Karts))
+	for _, id := range k.playerIDs() {
+		results = append(results, Result{PlayerID: id, Score: k.Karts[id].Score})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+
+	for i := range results {
+		if i > 0 && results[i].Score == results[i-1].Score {
+			results[i].Placement = results[i-1].Placement
+		} else {
+			results[i].Placement = i + 1
+		}
+	}
+	return results
+}
+
+// playerIDs returns the players in a stable order.
+func (k *Karts) playerIDs() []uint {
+	ids := make([]uint, 0, len(k.Karts))
+	for id := range k.Karts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func pairKey(a, b uint) string {
+	if a > b {
+		a, b = b, a
+	}
+	return strconv.FormatUint(uint64(a), 10) + ":" + strconv.FormatUint(uint64(b), 10)
+}
+
+func clamp(value, min, max float64) float64 {
+	return math.Max(min, math.Min(max, value))
+}
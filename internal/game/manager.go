@@ -0,0 +1,85 @@
+package game
+
+import (
+	"sync"
+	"time"
+)
+
+// Manager keeps one running Match per game room on this server.
+type Manager struct {
+	// Checkpoint, if set, is called from the match goroutine with the
+	// match tick and serialized state every few seconds and when the match
+	// ends. It should not block for long.
+	Checkpoint func(roomID uint, tick uint64, state []byte)
+
+	// Replay, if set, is called from the match goroutine about once a second
+	// with the replay events recorded since the previous call. It should not
+	// block for long.
+	Replay func(roomID uint, events []ReplayEvent)
+
+	// OnFinish, if set, is called once a match has ended, with the players'
+	// results and the final state.
+	OnFinish func(roomID uint, gameType string, results []Result, state []byte)
+
+	// SpectatorDelay holds back the snapshots spectators see, so they can't
+	// relay live positions to a player. Set it before starting matches.
+	SpectatorDelay time.Duration
+
+	mu      sync.Mutex
+	matches map[uint]*Match
+}
+
+func NewManager() *Manager {
+	return &Manager{matches: make(map[uint]*Match)}
+}
+
+// Start runs a match for the room unless one is already running. A non-empty
+// checkpoint resumes from it at tick; otherwise a new match is set up for
+// players, in seat order.
+func (m *Manager) Start(roomID uint, gameType string, players []uint, checkpoint []byte, tick uint64) (*Match, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if match, ok := m.matches[roomID]; ok {
+		return match, nil
+	}
+
+	def, ok := Lookup(gameType)
+	if !ok {
+		return nil, ErrUnsupportedGame
+	}
+
+	engine := def.New()
+	if len(checkpoint) > 0 {
+		if err := engine.Restore(checkpoint); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := engine.Init(players); err != nil {
+			return nil, err
+		}
+		tick = 0
+	}
+
+	match := newMatch(m, roomID, def, engine, tick)
+	m.matches[roomID] = match
+	go match.run()
+	return match, nil
+}
+
+// Get returns the room's running match, or nil.
+func (m *Manager) Get(roomID uint) *Match {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.matches[roomID]
+}
+
+func (m *Manager) finished(match *Match, state []byte) {
+	m.mu.Lock()
+	delete(m.matches, match.RoomID)
+	m.mu.Unlock()
+
+	if m.OnFinish != nil {
+		m.OnFinish(match.RoomID, match.Definition.GameType, match.engine.Results(), state)
+	}
+}
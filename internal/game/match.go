@@ -0,0 +1,247 @@
+package game
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	ws "github.com/rj-2006/techtalk/internal/websocket"
+)
+
+const (
+	// A full state keyframe is sent this often so clients that dropped a
+	// delta resynchronise.
+	keyframeInterval = 2 * time.Second
+	// The state is handed to the checkpoint hook this often.
+	checkpointInterval = 5 * time.Second
+
+	inputBuffer = 256
+)
+
+type input struct {
+	playerID uint
+	move     json.RawMessage
+}
+
+// MoveRejected tells a player their move was refused, with the full state so
+// the client can snap back.
+type MoveRejected struct {
+	Reason string      `json:"reason"`
+	State  interface{} `json:"state"`
+}
+
+// Match runs one game room's engine at its definition's tick rate.
+// Everything it owns is touched only by its run goroutine; other goroutines
+// talk to it through channels.
+type Match struct {
+	RoomID     uint
+	Definition Definition
+
+	manager *Manager
+	engine  GameEngine
+	ticks   uint64
+	replay  []ReplayEvent
+
+	inputs  chan input
+	join    chan *ws.Client
+	leave   chan *ws.Client
+	watch   chan *ws.Client
+	unwatch chan *ws.Client
+	done    chan struct{}
+
+	clients    map[*ws.Client]bool
+	spectators map[*ws.Client]bool
+	delayed    []spectatorFrame
+	latest     []byte // the last frame released to spectators
+}
+
+func newMatch(manager *Manager, roomID uint, def Definition, engine GameEngine, tick uint64) *Match {
+	return &Match{
+		RoomID:     roomID,
+		Definition: def,
+		manager:    manager,
+		engine:     engine,
+		ticks:      tick,
+		inputs:     make(chan input, inputBuffer),
+		join:       make(chan *ws.Client),
+		leave:      make(chan *ws.Client),
+		watch:      make(chan *ws.Client),
+		unwatch:    make(chan *ws.Client),
+		done:       make(chan struct{}),
+		clients:    make(map[*ws.Client]bool),
+		spectators: make(map[*ws.Client]bool),
+	}
+}
+
+// Join adds a connected player; they are sent the full state straight away.
+func (m *Match) Join(client *ws.Client) {
+	select {
+	case m.join <- client:
+	case <-m.done:
+	}
+}
+
+func (m *Match) Leave(client *ws.Client) {
+	select {
+	case m.leave <- client:
+	case <-m.done:
+	}
+}
+
+// Submit queues a move for the next tick. Moves are dropped if the match is
+// over or the queue is full; the next move supersedes them anyway.
+func (m *Match) Submit(playerID uint, move json.RawMessage) {
+	select {
+	case m.inputs <- input{playerID: playerID, move: move}:
+	default:
+	}
+}
+
+// Done is closed when the match has finished.
+func (m *Match) Done() <-chan struct{} {
+	return m.done
+}
+
+// everyTicks converts an interval into a tick count at this match's rate.
+func (m *Match) everyTicks(interval time.Duration) uint64 {
+	ticks := uint64(interval / m.Definition.TickInterval())
+	if ticks == 0 {
+		return 1
+	}
+	return ticks
+}
+
+func (m *Match) run() {
+	ticker := time.NewTicker(m.Definition.TickInterval())
+	defer ticker.Stop()
+
+	keyframe := m.everyTicks(keyframeInterval)
+	checkpoint := m.everyTicks(checkpointInterval)
+	replaySnapshot := m.everyTicks(replaySnapshotInterval)
+	replayFlush := m.everyTicks(replayFlushInterval)
+	spectate := m.everyTicks(spectatorInterval)
+	delay := m.manager.SpectatorDelay
+
+	m.recordSnapshot()
+	m.queueSpectatorFrame(delay)
+	m.releaseSpectatorFrames()
+
+	// Only the latest move per player counts for a tick.
+	pending := make(map[uint]json.RawMessage)
+
+	for {
+		select {
+		case client := <-m.join:
+			m.clients[client] = true
+			m.send(client, ws.Event{Type: ws.EventTypeGameSnapshot, Payload: m.engine.State()})
+
+		case client := <-m.leave:
+			delete(m.clients, client)
+
+		case client := <-m.watch:
+			m.spectators[client] = true
+			if m.latest != nil {
+				client.Enqueue(m.latest)
+			}
+
+		case client := <-m.unwatch:
+			delete(m.spectators, client)
+
+		case in := <-m.inputs:
+			pending[in.playerID] = in.move
+
+		case <-ticker.C:
+			for playerID, move := range pending {
+				if err := m.engine.ApplyMove(playerID, move); err != nil {
+					m.reject(playerID, err)
+					continue
+				}
+				m.recordInput(playerID, move)
+			}
+			clear(pending)
+
+			m.engine.Tick()
+			m.ticks++
+
+			if m.engine.Finished() {
+				m.finish()
+				return
+			}
+
+			if m.ticks%keyframe == 0 {
+				m.broadcast(ws.Event{Type: ws.EventTypeGameSnapshot, Payload: m.engine.Keyframe()})
+			} else if delta := m.engine.Delta(); delta != nil {
+				m.broadcast(ws.Event{Type: ws.EventTypeGameSnapshot, Payload: delta})
+			}
+
+			if m.ticks%spectate == 0 {
+				m.queueSpectatorFrame(delay)
+			}
+			m.releaseSpectatorFrames()
+
+			if m.ticks%replaySnapshot == 0 {
+				m.recordSnapshot()
+			}
+			if m.ticks%replayFlush == 0 {
+				m.flushReplay()
+			}
+			if m.ticks%checkpoint == 0 {
+				m.checkpoint()
+			}
+		}
+	}
+}
+
+func (m *Match) reject(playerID uint, err error) {
+	event := ws.Event{
+		Type:    ws.EventTypeMoveRejected,
+		Payload: MoveRejected{Reason: err.Error(), State: m.engine.State()},
+	}
+	for client := range m.clients {
+		if client.UserID == playerID {
+			m.send(client, event)
+		}
+	}
+}
+
+func (m *Match) finish() {
+	m.recordSnapshot()
+	m.flushReplay()
+	state := m.checkpoint()
+
+	// The result is public once the match is over, so spectators get it
+	// without the delay.
+	over := ws.Event{Type: ws.EventTypeGameOver, Payload: m.engine.State()}
+	m.broadcast(over)
+	data, _ := json.Marshal(over)
+	for client := range m.spectators {
+		client.Enqueue(data)
+	}
+	close(m.done)
+
+	m.manager.finished(m, state)
+}
+
+func (m *Match) checkpoint() []byte {
+	state, err := m.engine.Serialize()
+	if err != nil {
+		log.Printf("Failed to serialize game %d: %v", m.RoomID, err)
+		return nil
+	}
+	if m.manager.Checkpoint != nil {
+		m.manager.Checkpoint(m.RoomID, m.ticks, state)
+	}
+	return state
+}
+
+func (m *Match) broadcast(event ws.Event) {
+	data, _ := json.Marshal(event)
+	for client := range m.clients {
+		client.Enqueue(data)
+	}
+}
+
+func (m *Match) send(client *ws.Client, event ws.Event) {
+	data, _ := json.Marshal(event)
+	client.Enqueue(data)
+}
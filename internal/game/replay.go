@@ -0,0 +1,52 @@
+package game
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ReplayInput    = "i" // an accepted move, as the player sent it
+	ReplaySnapshot = "s" // the full public state, as from GameEngine.State
+
+	// replaySnapshotInterval is how often the full state is recorded, so
+	// playback can seek without replaying every input.
+	replaySnapshotInterval = time.Second
+	replayFlushInterval    = time.Second
+)
+
+// ReplayEvent is one entry in a match's append-only replay log. Tick counts
+// from the start of the match at the definition's tick rate. After a match
+// is resumed from a checkpoint, ticks restart from the checkpoint's tick,
+// with a snapshot first, so playback should follow log order and treat a
+// snapshot as a reset.
+type ReplayEvent struct {
+	Tick     uint64          `json:"tick"`
+	Kind     string          `json:"kind"`
+	PlayerID uint            `json:"player_id,omitempty"`
+	Data     json.RawMessage `json:"data"`
+}
+
+func (m *Match) recordInput(playerID uint, move json.RawMessage) {
+	m.replay = append(m.replay, ReplayEvent{
+		Tick:     m.ticks + 1, // the tick the move is applied in
+		Kind:     ReplayInput,
+		PlayerID: playerID,
+		Data:     move,
+	})
+}
+
+func (m *Match) recordSnapshot() {
+	data, _ := json.Marshal(m.engine.State())
+	m.replay = append(m.replay, ReplayEvent{Tick: m.ticks, Kind: ReplaySnapshot, Data: data})
+}
+
+func (m *Match) flushReplay() {
+	if len(m.replay) == 0 {
+		return
+	}
+	if m.manager.Replay != nil {
+		m.manager.Replay(m.RoomID, m.replay)
+	}
+	m.replay = nil
+}
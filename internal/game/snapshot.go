@@ -0,0 +1,92 @@
+package game
+
+import "math"
+
+// Snapshot is the state broadcast after a tick. A full snapshot lists every
+// field of every kart; otherwise only fields that changed since the previous
+// snapshot are set, and karts with no changes are left out.
+type Snapshot struct {
+	Tick      uint64      `json:"tick"`
+	Full      bool        `json:"full,omitempty"`
+	Remaining float64     `json:"remaining"` // seconds
+	Karts     []KartDelta `json:"karts"`
+}
+
+type KartDelta struct {
+	PlayerID  uint     `json:"player_id"`
+	X         *float64 `json:"x,omitempty"`
+	Y         *float64 `json:"y,omitempty"`
+	VelocityX *float64 `json:"velocity_x,omitempty"`
+	VelocityY *float64 `json:"velocity_y,omitempty"`
+	Rotation  *float64 `json:"rotation,omitempty"`
+	Score     *int     `json:"score,omitempty"`
+}
+
+// quantize rounds to hundredths so that float noise doesn't defeat the delta.
+func quantize(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func quantizedKart(kart *Kart) Kart {
+	return Kart{
+		PlayerID:  kart.PlayerID,
+		X:         quantize(kart.X),
+		Y:         quantize(kart.Y),
+		VelocityX: quantize(kart.VelocityX),
+		VelocityY: quantize(kart.VelocityY),
+		Rotation:  quantize(kart.Rotation),
+		Score:     kart.Score,
+	}
+}
+
+func changedFloat(current, previous float64, full bool) *float64 {
+	if !full && current == previous {
+		return nil
+	}
+	return &current
+}
+
+// snapshot builds the next snapshot against previous, the quantized karts from
+// the last one sent, and updates previous in place.
+func (k *Karts) snapshot(previous map[uint]Kart, full bool) Snapshot {
+	snapshot := Snapshot{
+		Tick:      k.Ticks,
+		Full:      full,
+		Remaining: k.remaining().Seconds(),
+		Karts:     make([]KartDelta, 0, len(k.Karts)),
+	}
+
+	for _, id := range k.playerIDs() {
+		current := quantizedKart(k.Karts[id])
+		before, seen := previous[id]
+		all := full || !seen
+
+		delta := KartDelta{
+			PlayerID:  id,
+			X:         changedFloat(current.X, before.X, all),
+			Y:         changedFloat(current.Y, before.Y, all),
+			VelocityX: changedFloat(current.VelocityX, before.VelocityX, all),
+			VelocityY: changedFloat(current.VelocityY, before.VelocityY, all),
+			Rotation:  changedFloat(current.Rotation, before.Rotation, all),
+		}
+		if all || current.Score != before.Score {
+			score := current.Score
+			delta.Score = &score
+		}
+		previous[id] = current
+
+		if delta.X == nil && delta.Y == nil && delta.VelocityX == nil && delta.VelocityY == nil &&
+			delta.Rotation == nil && delta.Score == nil {
+			continue
+		}
+		snapshot.Karts = append(snapshot.Karts, delta)
+	}
+
+	return snapshot
+}
+
+// fullSnapshot is a snapshot with every field set that does not disturb the
+// delta baseline, for clients joining mid-match, spectators and replays.
+func (k *Karts) fullSnapshot() Snapshot {
+	return k.snapshot(make(map[uint]Kart, len(k.Karts)), true)
+}
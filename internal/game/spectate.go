@@ -0,0 +1,52 @@
+package game
+
+import (
+	"encoding/json"
+	"time"
+
+	ws "github.com/rj-2006/techtalk/internal/websocket"
+)
+
+// Spectators get a full state this often rather than every tick's delta.
+const spectatorInterval = 500 * time.Millisecond
+
+type spectatorFrame struct {
+	at   time.Time
+	data []byte
+}
+
+// Watch adds a read-only spectator. They are sent the latest state they are
+// allowed to see straight away, then a snapshot every spectatorInterval,
+// held back by the manager's SpectatorDelay.
+func (m *Match) Watch(client *ws.Client) {
+	select {
+	case m.watch <- client:
+	case <-m.done:
+	}
+}
+
+func (m *Match) Unwatch(client *ws.Client) {
+	select {
+	case m.unwatch <- client:
+	case <-m.done:
+	}
+}
+
+// queueSpectatorFrame captures the current state for spectators, to be sent
+// once the delay has passed.
+func (m *Match) queueSpectatorFrame(delay time.Duration) {
+	data, _ := json.Marshal(ws.Event{Type: ws.EventTypeGameSnapshot, Payload: m.engine.State()})
+	m.delayed = append(m.delayed, spectatorFrame{at: time.Now().Add(delay), data: data})
+}
+
+// releaseSpectatorFrames sends spectators every queued frame that is due.
+func (m *Match) releaseSpectatorFrames() {
+	now := time.Now()
+	for len(m.delayed) > 0 && !m.delayed[0].at.After(now) {
+		m.latest = m.delayed[0].data
+		m.delayed = m.delayed[1:]
+		for client := range m.spectators {
+			client.Enqueue(m.latest)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/mail"
+	"github.com/rj-2006/techtalk/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	EmailVerificationTTL = 48 * time.Hour
+	PasswordResetTTL     = time.Hour
+)
+
+var Mailer mail.Mailer
+
+// AppURL is the frontend's base URL, used to build the links in emails.
+var AppURL = "http://localhost:5173"
+
+var errInvalidEmailToken = errors.New("invalid or expired token")
+
+// issueEmailToken replaces any unused tokens the user has for purpose with a
+// new one and returns it.
+func issueEmailToken(tx *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Delete(&models.EmailToken{}).Error; err != nil {
+		return "", err
+	}
+
+	record := models.EmailToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeEmailToken marks a token used and returns its user ID. The update is
+// conditional, so a token can only be redeemed once.
+func consumeEmailToken(tx *gorm.DB, token, purpose string) (uint, error) {
+	var record models.EmailToken
+	err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errInvalidEmailToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	result := tx.Model(&models.EmailToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", record.ID, now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, errInvalidEmailToken
+	}
+	return record.UserID, nil
+}
+
+func appLink(path, token string) string {
+	return strings.TrimRight(AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendMail delivers in the background so a slow mail server doesn't hold up
+// the request.
+func sendMail(msg mail.Message) {
+	if Mailer == nil {
+		log.Printf("No mailer configured; dropping mail to %s", msg.To)
+		return
+	}
+	go func() {
+		if err := Mailer.Send(msg); err != nil {
+			log.Printf("Failed to send mail to %s: %v", msg.To, err)
+		}
+	}()
+}
+
+func sendVerificationEmail(user models.User) error {
+	token, err := issueEmailToken(database.DB, user.ID, models.EmailTokenVerify, EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening this link:\n\n%s\n\nThe link expires in %d hours.\n",
+			user.Username, appLink("/verify-email", token), int(EmailVerificationTTL.Hours())),
+	})
+	return nil
+}
+
+// VerifyEmail redeems a verification token from a signup or resend email.
+func VerifyEmail(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		userID, err := consumeEmailToken(tx, req.Token, models.EmailTokenVerify)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ? AND email_verified_at IS NULL", userID).
+			Update("email_verified_at", time.Now()).Error
+	})
+	if errors.Is(err, errInvalidEmailToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerification mails the current user a fresh verification link.
+func ResendVerification(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already verified"})
+		return
+	}
+	if mailBlocked(c, user.Email) {
+		return
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// ForgotPassword mails a reset link if the address belongs to an account. The
+// response is the same either way so it can't be used to probe for accounts.
+func ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Counted whether or not the account exists, so the limit doesn't reveal
+	// that either.
+	if mailBlocked(c, req.Email) {
+		return
+	}
+
+	response := gin.H{"message": "If that email belongs to an account, a reset link has been sent"}
+
+	var user models.User
+	if err := database.DB.Where("email = ? AND is_bot = ?", req.Email, false).First(&user).Error; err != nil {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+
+	token, err := issueEmailToken(database.DB, user.ID, models.EmailTokenReset, PasswordResetTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start password reset"})
+		return
+	}
+
+	sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset your password. If it was you, open this link:\n\n%s\n\nThe link expires in %d minutes. If you didn't ask, you can ignore this email.\n",
+			user.Username, appLink("/reset-password", token), int(PasswordResetTTL.Minutes())),
+	})
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ResetPassword sets a new password from a reset token, signs the user out of
+// every session and revokes their personal access tokens. Redeeming the
+// emailed token also proves the address, so it is marked verified.
+func ResetPassword(c *gin.Context) {
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	var userID uint
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		id, err := consumeEmailToken(tx, req.Token, models.EmailTokenReset)
+		if err != nil {
+			return err
+		}
+		userID = id
+		if err := tx.Model(&models.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"password":          string(hashedPassword),
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+		}).Error; err != nil {
+			return err
+		}
+		return revokeUserTokens(tx, id)
+	})
+	if errors.Is(err, errInvalidEmailToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	if err := revokeUserSessions(userID); err != nil {
+		log.Printf("Failed to revoke sessions for user %d after password reset: %v", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"time"
 
@@ -12,12 +13,26 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-func issueToken(user models.User) (string, error) {
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+func issueToken(user models.User, sessionID string, twoFactor bool) (string, error) {
+	roles, err := userRoleNames(user.ID)
+	if err != nil {
+		return "", err
+	}
+
 	claims := &middleware.Claims{
-		UserID:   user.ID,
-		Username: user.Username,
+		UserID:        user.ID,
+		Username:      user.Username,
+		Roles:         roles,
+		TwoFactor:     twoFactor,
+		EmailVerified: user.EmailVerifiedAt != nil,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
@@ -49,6 +64,15 @@ func Register(c *gin.Context) {
 		return
 	}
 
+	// Every signup counts against the address, successful or not.
+	if wait := retryAfter(RegisterLimiter, c.ClientIP(), 0); wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return
+	}
+	if _, err := RegisterLimiter.Fail(c.ClientIP()); err != nil {
+		log.Printf("Failed to record signup attempt: %v", err)
+	}
+
 	//hashing passwords
 
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -67,20 +91,32 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	tokenString, err := issueToken(user)
+	if err := assignRole(user.ID, RoleMember); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign default role"})
+		return
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
+	tokens, err := startSession(c, user, false)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token."})
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "User created successfully",
-		"token":   tokenString,
+		"message":       "User created successfully",
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"avatar":   user.Avatar,
+			"id":             user.ID,
+			"username":       user.Username,
+			"email":          user.Email,
+			"avatar":         user.Avatar,
+			"email_verified": user.EmailVerifiedAt != nil,
 		},
 	})
 }
@@ -92,32 +128,73 @@ func Login(c *gin.Context) {
 		return
 	}
 
+	if loginBlocked(c, req.Email) {
+		return
+	}
+
 	var user models.User
 
 	if err := database.DB.Where("email=?", req.Email).First(&user).Error; err != nil {
+		recordLoginFailure(c, req.Email, nil, models.LoginFailBadPassword)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Credentials"})
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		recordLoginFailure(c, req.Email, &user.ID, models.LoginFailBadPassword)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Credentials"})
 		return
 	}
 
-	tokenString, err := issueToken(user)
+	// With 2FA on, the password only earns a challenge token; the session
+	// is started by VerifyLoginChallenge once a code checks out.
+	if user.TOTPEnabledAt != nil {
+		challenge, err := startLoginChallenge(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int(LoginChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	completeLogin(c, user, false)
+}
+
+// completeLogin starts a session and writes the login response.
+func completeLogin(c *gin.Context, user models.User, twoFactor bool) {
+	recordLoginSuccess(user.Email)
+
+	tokens, err := startSession(c, user, twoFactor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token."})
+		return
+	}
+
+	roles, err := userRoleNames(user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token."})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token": tokenString,
+		"token":         tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"expires_in":    tokens.ExpiresIn,
+		// Set when a role requires 2FA the user hasn't enrolled in yet;
+		// until they do, only account routes accept this token.
+		"two_factor_setup_required": !twoFactor && middleware.RequiresTwoFactor(roles),
 		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"email":    user.Email,
-			"avatar":   user.Avatar,
+			"id":                 user.ID,
+			"username":           user.Username,
+			"email":              user.Email,
+			"avatar":             user.Avatar,
+			"email_verified":     user.EmailVerifiedAt != nil,
+			"two_factor_enabled": user.TOTPEnabledAt != nil,
 		},
 	})
-
 }
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
@@ -10,8 +11,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/middleware"
 	"github.com/rj-2006/techtalk/internal/models"
 	ws "github.com/rj-2006/techtalk/internal/websocket"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 var upgrader = websocket.Upgrader{
@@ -28,6 +32,7 @@ func CreateChatroom(c *gin.Context) {
 	var req struct {
 		Name        string `json:"name" binding:"required,min=3,max=100"`
 		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -35,15 +40,31 @@ func CreateChatroom(c *gin.Context) {
 		return
 	}
 
+	if req.Visibility == "" {
+		req.Visibility = models.ChatroomPublic
+	}
+	if !isValidVisibility(req.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid visibility (public, invite_only, private)"})
+		return
+	}
+
 	userID := c.GetUint("user_id")
 
 	chatroom := models.Chatroom{
 		Name:        req.Name,
 		Description: req.Description,
+		Visibility:  req.Visibility,
 		CreatedBy:   userID,
 	}
 
-	if err := database.DB.Create(&chatroom).Error; err != nil {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&chatroom).Error; err != nil {
+			return err
+		}
+		_, err := addRoomMember(tx, chatroom.ID, userID, models.ChatroomRoleOwner)
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create chatroom."})
 		return
 	}
@@ -52,16 +73,32 @@ func CreateChatroom(c *gin.Context) {
 }
 
 func GetChatrooms(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
 	var chatrooms []models.Chatroom
 
-	if err := database.DB.Order("created_at DESC").Find(&chatrooms).Error; err != nil {
+	if err := database.DB.Scopes(visibleRooms(userID)).
+		Where("kind = ?", models.ChatroomKindRoom).
+		Order("created_at DESC").
+		Find(&chatrooms).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch chatrooms."})
 		return
 	}
 
+	var memberships []models.ChatroomMember
+	if err := database.DB.Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch chatrooms."})
+		return
+	}
+	roles := make(map[uint]string, len(memberships))
+	for _, member := range memberships {
+		roles[member.ChatroomID] = member.Role
+	}
+
 	type ChatroomWithCount struct {
 		models.Chatroom
-		ActiveUsers int `json:"active_users"`
+		ActiveUsers int    `json:"active_users"`
+		Role        string `json:"role,omitempty"`
 	}
 
 	result := make([]ChatroomWithCount, len(chatrooms))
@@ -69,12 +106,35 @@ func GetChatrooms(c *gin.Context) {
 		result[i] = ChatroomWithCount{
 			Chatroom:    room,
 			ActiveUsers: ChatHub.GetRoomClients(strconv.Itoa(int(room.ID))),
+			Role:        roles[room.ID],
 		}
 	}
 
 	c.JSON(http.StatusOK, result)
 }
 
+const (
+	DefaultHistoryLimit = 50
+	MaxHistoryLimit     = 100
+)
+
+// historyCursor turns a before/after cursor (a message ID or an RFC3339
+// timestamp) into a where clause against chat_messages.
+func historyCursor(value, op string) (string, interface{}, error) {
+	if id, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return "id " + op + " ?", id, nil
+	}
+	ts, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return "", nil, err
+	}
+	return "created_at " + op + " ?", ts, nil
+}
+
+// GetChatHistory pages through a room's messages. Without a cursor, or with
+// `before`, it returns the newest messages first and next_cursor points at the
+// oldest one returned. With `after` it walks forward in chronological order
+// and next_cursor points at the newest one returned.
 func GetChatHistory(c *gin.Context) {
 	roomID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -82,16 +142,75 @@ func GetChatHistory(c *gin.Context) {
 		return
 	}
 
-	var messages []models.ChatMessage
+	if _, ok := accessibleRoom(c, uint(roomID)); !ok {
+		return
+	}
+
+	limit := DefaultHistoryLimit
+	if raw := c.Query("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+
+	before, after := c.Query("before"), c.Query("after")
+	if before != "" && after != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Use either before or after, not both"})
+		return
+	}
+
+	query := database.DB.Where("chatroom_id = ?", roomID).
+		Preload("User").
+		Preload("Reactions").
+		Preload("Reactions.User")
+
+	forward := after != ""
+	switch {
+	case forward:
+		clause, arg, err := historyCursor(after, ">")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		query = query.Where(clause, arg).Order("id ASC")
+	case before != "":
+		clause, arg, err := historyCursor(before, "<")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		query = query.Where(clause, arg).Order("id DESC")
+	default:
+		query = query.Order("id DESC")
+	}
 
-	if err := database.DB.Where("chatroom_id = ?", roomID).Preload("User").Order(
-		"created_at ASC").Limit(100).Find(&messages).Error; err != nil {
+	var messages []models.ChatMessage
+	if err := query.Limit(limit + 1).Find(&messages).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error": "Failed to fetch chat messages."})
 		return
 	}
 
-	c.JSON(http.StatusOK, messages)
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	var nextCursor *uint
+	if hasMore && len(messages) > 0 {
+		nextCursor = &messages[len(messages)-1].ID
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages":    messages,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+	})
 }
 
 func HandleChatWebsocket(c *gin.Context) {
@@ -100,23 +219,52 @@ func HandleChatWebsocket(c *gin.Context) {
 	userID := c.GetUint("user_id")
 	username := c.GetString("username")
 
+	id, err := strconv.Atoi(roomID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid RoomID"})
+		return
+	}
+
+	if _, ok := accessibleRoom(c, uint(id)); !ok {
+		return
+	}
+
+	var lastEventID uint64
+	if raw := c.Query("last_event_id"); raw != "" {
+		lastEventID, err = strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid last_event_id"})
+			return
+		}
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("Websocket upgrade failed: %v", err)
 		return
 	}
 
-	client := &ws.Client{
-		Hub:      ChatHub,
-		Conn:     conn,
-		Send:     make(chan []byte, 256),
-		RoomID:   roomID,
-		UserID:   userID,
-		Username: username,
-	}
+	roles, _ := c.Get("roles")
+	roleNames, _ := roles.([]string)
+
+	client := ws.NewClient(ChatHub, conn, roomID, userID, username, roleNames)
 
+	// Registering first means nothing broadcast from here on is missed. Live
+	// events are held while the replay is written and released after it, minus
+	// any message the replay already sent.
+	if lastEventID > 0 {
+		client.Hold()
+	}
 	client.Hub.Register <- client
 
+	if lastEventID > 0 {
+		newest, err := replayMissedEvents(client, uint(id), uint(lastEventID))
+		if err != nil {
+			log.Printf("Failed to replay events for %s in room %s: %v", username, roomID, err)
+		}
+		client.Release(newest)
+	}
+
 	go client.WritePump()
 	go handleChatMessages(client)
 }
@@ -159,40 +307,93 @@ func handleChatMessages(client *ws.Client) {
 			if content == "" {
 				continue
 			}
-
-			roomID, _ := strconv.Atoi(client.RoomID)
-			chatMessage := models.ChatMessage{
-				ChatroomID: uint(roomID),
-				UserID:     client.UserID,
-				Content:    content,
+			if len(msg.ClientMsgID) > MaxClientMsgIDLength {
+				sendFrameError(client, msg.ClientMsgID, "client_msg_id too long")
+				continue
 			}
 
-			if err := database.DB.Create(&chatMessage).Error; err != nil {
+			chatMessage, duplicate, err := saveChatMessage(client, content, msg.ClientMsgID)
+			if err != nil {
 				log.Printf("Failed to save chat message: %v", err)
+				sendFrameError(client, msg.ClientMsgID, "failed to send message")
 				continue
 			}
 
-			if err := database.DB.Preload("User").First(&chatMessage, chatMessage.ID).Error; err != nil {
-				log.Printf("Failed to hydrate chat message: %v", err)
+			sendAck(client, ws.AckMessage{
+				ClientMsgID: msg.ClientMsgID,
+				MessageID:   chatMessage.ID,
+				CreatedAt:   chatMessage.CreatedAt.Format(time.RFC3339),
+				Duplicate:   duplicate,
+			})
+			if duplicate {
 				continue
 			}
 
 			data, _ := json.Marshal(ws.Event{
-				Type: ws.EventTypeNewMessage,
-				Payload: ws.OutgoingChatMessage{
-					ID:         chatMessage.ID,
-					ChatroomID: chatMessage.ChatroomID,
-					UserID:     chatMessage.UserID,
-					User:       chatMessage.User,
-					Content:    chatMessage.Content,
-					CreatedAt:  chatMessage.CreatedAt.Format(time.RFC3339),
-					Reactions:  chatMessage.Reactions,
-				},
+				Type:    ws.EventTypeNewMessage,
+				EventID: chatMessage.ID,
+				Payload: outgoingChatMessage(*chatMessage),
 			})
 			client.Hub.Broadcast <- &ws.BroadcastMessage{
 				RoomID:  client.RoomID,
 				Message: data,
 			}
+		case ws.MessageTypeEditMessage:
+			var payload ws.EditMessagePayload
+			if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.MessageID == 0 || payload.Content == "" {
+				sendFrameError(client, msg.ClientMsgID, "Invalid edit payload")
+				continue
+			}
+
+			if err := editChatMessage(client, payload); err != nil {
+				sendFrameError(client, msg.ClientMsgID, err.Error())
+				continue
+			}
+			sendAck(client, ws.AckMessage{ClientMsgID: msg.ClientMsgID, MessageID: payload.MessageID})
+		case ws.MessageTypeDeleteMessage:
+			var payload ws.DeleteMessagePayload
+			if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.MessageID == 0 {
+				sendFrameError(client, msg.ClientMsgID, "Invalid delete payload")
+				continue
+			}
+
+			if err := deleteChatMessage(client, payload); err != nil {
+				sendFrameError(client, msg.ClientMsgID, err.Error())
+				continue
+			}
+			sendAck(client, ws.AckMessage{ClientMsgID: msg.ClientMsgID, MessageID: payload.MessageID})
+		case ws.MessageTypeReaction:
+			var payload ws.ReactionMessage
+			if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.MessageID == 0 {
+				sendFrameError(client, msg.ClientMsgID, "Invalid reaction payload")
+				continue
+			}
+
+			roomID, _ := strconv.Atoi(client.RoomID)
+			if _, err := applyMessageReaction(uint(roomID), payload.MessageID, client.UserID, client.Username,
+				payload.Emoji, payload.Action); err != nil {
+				if reactionErrorStatus(err) == http.StatusInternalServerError {
+					log.Printf("Failed to apply reaction to message %d: %v", payload.MessageID, err)
+				}
+				sendFrameError(client, msg.ClientMsgID, reactionErrorMessage(err))
+				continue
+			}
+			sendAck(client, ws.AckMessage{ClientMsgID: msg.ClientMsgID, MessageID: payload.MessageID})
+		case ws.MessageTypePresence:
+			var payload ws.PresenceMessage
+			if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+				sendError(client, "Invalid presence payload")
+				continue
+			}
+
+			switch payload.Status {
+			case ws.StatusIdle:
+				client.Hub.SetIdle(client, true)
+			case ws.StatusOnline:
+				client.Hub.SetIdle(client, false)
+			default:
+				sendError(client, "Invalid presence status")
+			}
 		case ws.MessageTypeTyping:
 			data, _ := json.Marshal(ws.Event{
 				Type: ws.MessageTypeTyping,
@@ -202,9 +403,183 @@ func handleChatMessages(client *ws.Client) {
 				},
 			})
 			client.Hub.Broadcast <- &ws.BroadcastMessage{
-				RoomID:  client.RoomID,
-				Message: data,
+				RoomID:      client.RoomID,
+				Message:     data,
+				CoalesceKey: "typing:" + strconv.Itoa(int(client.UserID)),
 			}
 		}
 	}
 }
+
+func broadcastEvent(roomID string, event ws.Event) {
+	data, _ := json.Marshal(event)
+	ChatHub.Broadcast <- &ws.BroadcastMessage{
+		RoomID:  roomID,
+		Message: data,
+	}
+}
+
+func sendError(client *ws.Client, message string) {
+	sendFrameError(client, "", message)
+}
+
+// sendFrameError reports a failed frame, echoing its client_msg_id so the
+// client knows which send to retry or give up on.
+func sendFrameError(client *ws.Client, clientMsgID, message string) {
+	data, _ := json.Marshal(ws.Event{
+		Type:    ws.MessageTypeError,
+		Payload: ws.ErrorMessage{Message: message, ClientMsgID: clientMsgID},
+	})
+	client.Enqueue(data)
+}
+
+// sendAck confirms a frame that carried a client_msg_id; frames without one
+// are not acknowledged.
+func sendAck(client *ws.Client, ack ws.AckMessage) {
+	if ack.ClientMsgID == "" {
+		return
+	}
+	data, _ := json.Marshal(ws.Event{Type: ws.EventTypeAck, Payload: ack})
+	client.Enqueue(data)
+}
+
+const MaxClientMsgIDLength = 64
+
+// saveChatMessage stores a message sent over the socket. When clientMsgID has
+// already been used by this user, the existing message is returned with
+// duplicate set and nothing is written.
+func saveChatMessage(client *ws.Client, content, clientMsgID string) (*models.ChatMessage, bool, error) {
+	roomID, _ := strconv.Atoi(client.RoomID)
+	chatMessage := models.ChatMessage{
+		ChatroomID: uint(roomID),
+		UserID:     client.UserID,
+		Content:    content,
+	}
+	if clientMsgID != "" {
+		chatMessage.ClientMsgID = &clientMsgID
+	}
+
+	result := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&chatMessage)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+
+	duplicate := result.RowsAffected == 0
+	query := database.DB.Preload("User")
+	if duplicate {
+		query = query.Where("user_id = ? AND client_msg_id = ?", client.UserID, clientMsgID)
+	} else {
+		query = query.Where("id = ?", chatMessage.ID)
+	}
+	if err := query.First(&chatMessage).Error; err != nil {
+		return nil, false, err
+	}
+
+	return &chatMessage, duplicate, nil
+}
+
+func outgoingChatMessage(message models.ChatMessage) ws.OutgoingChatMessage {
+	out := ws.OutgoingChatMessage{
+		ID:         message.ID,
+		ChatroomID: message.ChatroomID,
+		UserID:     message.UserID,
+		User:       message.User,
+		Content:    message.Content,
+		CreatedAt:  message.CreatedAt.Format(time.RFC3339),
+		Reactions:  message.Reactions,
+		Bot:        message.User.IsBot,
+	}
+	if message.EditedAt != nil {
+		out.EditedAt = message.EditedAt.Format(time.RFC3339)
+	}
+	return out
+}
+
+func findRoomMessage(client *ws.Client, messageID uint) (*models.ChatMessage, error) {
+	roomID, _ := strconv.Atoi(client.RoomID)
+
+	var message models.ChatMessage
+	if err := database.DB.Where("id = ? AND chatroom_id = ? AND deleted_at IS NULL", messageID, roomID).
+		First(&message).Error; err != nil {
+		return nil, errMessageNotFound
+	}
+	return &message, nil
+}
+
+// editChatMessage lets the author rewrite a message and tells the room.
+func editChatMessage(client *ws.Client, payload ws.EditMessagePayload) error {
+	message, err := findRoomMessage(client, payload.MessageID)
+	if err != nil {
+		return err
+	}
+
+	if message.UserID != client.UserID {
+		return errors.New("only the author can edit this message")
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(message).Updates(map[string]interface{}{
+		"content":   payload.Content,
+		"edited_at": now,
+	}).Error; err != nil {
+		log.Printf("Failed to edit chat message: %v", err)
+		return errors.New("failed to edit message")
+	}
+
+	if err := database.DB.Preload("User").Preload("Reactions").First(message, message.ID).Error; err != nil {
+		log.Printf("Failed to hydrate chat message: %v", err)
+		return errors.New("failed to edit message")
+	}
+
+	broadcastEvent(client.RoomID, ws.Event{
+		Type:    ws.EventTypeMessageEdited,
+		Payload: outgoingChatMessage(*message),
+	})
+	return nil
+}
+
+// deleteChatMessage replaces a message with a tombstone. The author and chat
+// moderators may delete.
+func deleteChatMessage(client *ws.Client, payload ws.DeleteMessagePayload) error {
+	message, err := findRoomMessage(client, payload.MessageID)
+	if err != nil {
+		return err
+	}
+
+	var room models.Chatroom
+	if err := database.DB.First(&room, message.ChatroomID).Error; err != nil {
+		return errMessageNotFound
+	}
+
+	if message.UserID != client.UserID &&
+		!isRoomModerator(&room, client.UserID) &&
+		!middleware.HasPermission(client.Roles, middleware.PermChatModerate) {
+		return errors.New("you cannot delete this message")
+	}
+
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("message_id = ?", message.ID).Delete(&models.MessageReaction{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(message).Updates(map[string]interface{}{
+			"content":    DeletedPlaceholder,
+			"deleted_at": now,
+		}).Error
+	})
+	if err != nil {
+		log.Printf("Failed to delete chat message: %v", err)
+		return errors.New("failed to delete message")
+	}
+
+	broadcastEvent(client.RoomID, ws.Event{
+		Type: ws.EventTypeMessageDeleted,
+		Payload: ws.MessageDeletedMessage{
+			MessageID:  message.ID,
+			ChatroomID: message.ChatroomID,
+			DeletedBy:  client.UserID,
+			DeletedAt:  now.Format(time.RFC3339),
+		},
+	})
+	return nil
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/models"
+	ws "github.com/rj-2006/techtalk/internal/websocket"
+	"gorm.io/gorm"
+)
+
+const MaxDMParticipants = 9
+
+func dmKey(userIDs []uint) string {
+	parts := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(parts, ":")
+}
+
+// OpenDM returns the DM conversation between the caller and the given users,
+// creating it on first use. The same participant set always maps to the same
+// conversation.
+func OpenDM(c *gin.Context) {
+	var req struct {
+		UserIDs []uint `json:"user_ids" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+
+	participants := append([]uint{userID}, req.UserIDs...)
+	slices.Sort(participants)
+	participants = slices.Compact(participants)
+
+	if len(participants) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A DM needs at least one other user"})
+		return
+	}
+	if len(participants) > MaxDMParticipants {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many participants"})
+		return
+	}
+
+	var found int64
+	if err := database.DB.Model(&models.User{}).Where("id IN ?", participants).Count(&found).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open DM"})
+		return
+	}
+	if int(found) != len(participants) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	key := dmKey(participants)
+
+	var room models.Chatroom
+	created := false
+	err := database.DB.Where("dm_key = ?", key).First(&room).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		room = models.Chatroom{
+			Name:       "Direct message",
+			Visibility: models.ChatroomPrivate,
+			Kind:       models.ChatroomKindDM,
+			DMKey:      &key,
+			CreatedBy:  userID,
+		}
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&room).Error; err != nil {
+				return err
+			}
+			for _, id := range participants {
+				if _, err := addRoomMember(tx, room.ID, id, models.ChatroomRoleMember); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			// Lost a race with another request opening the same DM.
+			err = database.DB.Where("dm_key = ?", key).First(&room).Error
+		} else {
+			created = true
+		}
+	}
+	if err == nil && !created {
+		// Participants who left the conversation rejoin when it is reopened;
+		// otherwise they could no longer read it.
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			for _, id := range participants {
+				if _, err := addRoomMember(tx, room.ID, id, models.ChatroomRoleMember); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open DM"})
+		return
+	}
+
+	var members []models.ChatroomMember
+	database.DB.Where("chatroom_id = ?", room.ID).Preload("User").Find(&members)
+
+	c.JSON(http.StatusOK, gin.H{
+		"chatroom":     room,
+		"participants": members,
+	})
+}
+
+type DMConversation struct {
+	Chatroom     models.Chatroom         `json:"chatroom"`
+	Participants []models.User           `json:"participants"`
+	LastMessage  *ws.OutgoingChatMessage `json:"last_message"`
+	UnreadCount  int64                   `json:"unread_count"`
+}
+
+// GetDMs lists the caller's DM conversations, most recently active first.
+func GetDMs(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var rooms []models.Chatroom
+	if err := database.DB.
+		Joins("JOIN chatroom_members ON chatroom_members.chatroom_id = chatrooms.id").
+		Where("chatrooms.kind = ? AND chatroom_members.user_id = ?", models.ChatroomKindDM, userID).
+		Find(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+
+	conversations := make([]DMConversation, 0, len(rooms))
+	if len(rooms) == 0 {
+		c.JSON(http.StatusOK, conversations)
+		return
+	}
+
+	roomIDs := make([]uint, len(rooms))
+	for i, room := range rooms {
+		roomIDs[i] = room.ID
+	}
+
+	var members []models.ChatroomMember
+	if err := database.DB.Where("chatroom_id IN ?", roomIDs).Preload("User").Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+	participants := make(map[uint][]models.User, len(rooms))
+	for _, member := range members {
+		participants[member.ChatroomID] = append(participants[member.ChatroomID], member.User)
+	}
+
+	var lastMessages []models.ChatMessage
+	if err := database.DB.Raw(`SELECT DISTINCT ON (chatroom_id) * FROM chat_messages
+		WHERE chatroom_id IN ? ORDER BY chatroom_id, id DESC`, roomIDs).
+		Scan(&lastMessages).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+	lastByRoom := make(map[uint]models.ChatMessage, len(lastMessages))
+	for _, message := range lastMessages {
+		lastByRoom[message.ChatroomID] = message
+	}
+
+	var unread []struct {
+		ChatroomID uint
+		Count      int64
+	}
+	if err := database.DB.Table("chat_messages").
+		Select("chat_messages.chatroom_id, COUNT(*) AS count").
+		Joins(`JOIN chatroom_members ON chatroom_members.chatroom_id = chat_messages.chatroom_id
+			AND chatroom_members.user_id = ?`, userID).
+		Where("chat_messages.chatroom_id IN ?", roomIDs).
+		Where("chat_messages.id > chatroom_members.last_read_id").
+		Where("chat_messages.user_id <> ? AND chat_messages.deleted_at IS NULL", userID).
+		Group("chat_messages.chatroom_id").
+		Scan(&unread).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch conversations"})
+		return
+	}
+	unreadByRoom := make(map[uint]int64, len(unread))
+	for _, row := range unread {
+		unreadByRoom[row.ChatroomID] = row.Count
+	}
+
+	usersByID := make(map[uint]models.User, len(members))
+	for _, member := range members {
+		usersByID[member.UserID] = member.User
+	}
+
+	activity := make(map[uint]time.Time, len(rooms))
+	for _, room := range rooms {
+		conversation := DMConversation{
+			Chatroom:     room,
+			Participants: participants[room.ID],
+			UnreadCount:  unreadByRoom[room.ID],
+		}
+		activity[room.ID] = room.CreatedAt
+		if message, ok := lastByRoom[room.ID]; ok {
+			message.User = usersByID[message.UserID]
+			out := outgoingChatMessage(message)
+			conversation.LastMessage = &out
+			activity[room.ID] = message.CreatedAt
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	sort.SliceStable(conversations, func(i, j int) bool {
+		return activity[conversations[i].Chatroom.ID].After(activity[conversations[j].Chatroom.ID])
+	})
+
+	c.JSON(http.StatusOK, conversations)
+}
+
+// MarkChatroomRead moves the caller's read marker forward, which drives the
+// unread counts in GetDMs.
+func MarkChatroomRead(c *gin.Context) {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid RoomID"})
+		return
+	}
+
+	var req struct {
+		MessageID uint `json:"message_id" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := database.DB.Model(&models.ChatroomMember{}).
+		Where("chatroom_id = ? AND user_id = ? AND last_read_id < ?", roomID, c.GetUint("user_id"), req.MessageID).
+		Update("last_read_id", req.MessageID)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update read marker"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Marked as read"})
+}
@@ -17,22 +17,9 @@ const (
 	MaxEmojiSize = 1 * 1024 * 1024
 )
 
-var adminUserIDs = map[uint]bool{
-	1: true,
-}
-
-func isAdmin(userID uint) bool {
-	return adminUserIDs[userID]
-}
-
 func CreateCustomEmoji(c *gin.Context) {
 	userID := c.GetUint("user_id")
 
-	if !isAdmin(userID) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
-		return
-	}
-
 	name := c.PostForm("name")
 	if name == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Emoji name required"})
@@ -107,13 +94,6 @@ func GetCustomEmojis(c *gin.Context) {
 }
 
 func DeleteCustomEmoji(c *gin.Context) {
-	userID := c.GetUint("user_id")
-
-	if !isAdmin(userID) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
-		return
-	}
-
 	emojiID := c.Param("id")
 
 	var emoji models.CustomEmoji
@@ -0,0 +1,19 @@
+package handlers
+
+import "github.com/rj-2006/techtalk/internal/events"
+
+const (
+	TopicSessionRevoked = "session_revoked"
+	TopicRolesChanged   = "roles_changed"
+)
+
+// Events tells other server instances about changes to the caches each keeps
+// in memory. The default suits a single node.
+var Events events.Bus = events.NewMemoryBus()
+
+// SubscribeEvents registers the handlers for events from other nodes. Call it
+// before Events.Start.
+func SubscribeEvents() {
+	Events.Subscribe(TopicSessionRevoked, onSessionRevoked)
+	Events.Subscribe(TopicRolesChanged, onRolesChanged)
+}
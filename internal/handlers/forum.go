@@ -1,13 +1,23 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/middleware"
 	"github.com/rj-2006/techtalk/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errPostDeleted   = errors.New("post has been deleted")
+	errThreadDeleted = errors.New("thread has been deleted")
 )
 
 func CreateThread(c *gin.Context) {
@@ -43,6 +53,7 @@ func CreateThread(c *gin.Context) {
 			Content:  req.Content,
 			ThreadID: thread.ID,
 			UserID:   userID,
+			Bot:      c.GetBool("bot"),
 		}
 		database.DB.Create(&post)
 	}
@@ -101,28 +112,163 @@ func GetThread(c *gin.Context) {
 	c.JSON(http.StatusOK, thread)
 }
 
+const (
+	DefaultThreadPageSize = 20
+	MaxThreadPageSize     = 50
+)
+
+var threadSortOrders = map[string]string{
+	"newest":    "threads.created_at DESC, threads.id DESC",
+	"activity":  "last_activity_at DESC, threads.id DESC",
+	"replies":   "post_count DESC, threads.id DESC",
+	"reactions": "reaction_count DESC, threads.id DESC",
+}
+
+type ThreadSummary struct {
+	models.Thread
+	PostCount      int64          `json:"post_count"`
+	ReactionCount  int64          `json:"reaction_count"`
+	ReactionCounts map[string]int `json:"reaction_counts" gorm:"-"`
+	LastPostAt     *time.Time     `json:"last_post_at"`
+	LastPostUserID *uint          `json:"last_post_user_id"`
+	LastPostUser   *models.User   `json:"last_post_user,omitempty" gorm:"-"`
+	LastActivityAt time.Time      `json:"last_activity_at"`
+}
+
+// GetThreads lists thread summaries a page at a time. Post bodies are left to
+// GetThread; here each thread only carries counts and its latest activity.
 func GetThreads(c *gin.Context) {
-	var threads []models.Thread
-	query := database.DB.
-		Preload("User").
-		Preload("Posts").
-		Preload("Posts.User").
-		Preload("Images").
-		Preload("Reactions").
-		Preload("Reactions.User").
-		Order("created_at DESC")
-
-	search := c.Query("search")
-	if search != "" {
-		query = query.Where("title ILIKE ?", "%"+search+"%")
-	}
-
-	if err := query.Find(&threads).Error; err != nil {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultThreadPageSize)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit > MaxThreadPageSize {
+		limit = MaxThreadPageSize
+	}
+
+	sort := c.DefaultQuery("sort", "newest")
+	order, ok := threadSortOrders[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort (newest, activity, replies, reactions)"})
+		return
+	}
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		db = db.Where("threads.deleted_at IS NULL")
+		if search := c.Query("search"); search != "" {
+			db = db.Where("threads.title ILIKE ?", "%"+search+"%")
+		}
+		return db
+	}
+
+	var total int64
+	if err := database.DB.Model(&models.Thread{}).Scopes(filter).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch threads"})
+		return
+	}
+
+	threads := []ThreadSummary{}
+	if err := database.DB.Table("threads").
+		Select(`threads.*,
+			(SELECT COUNT(*) FROM posts WHERE posts.thread_id = threads.id AND posts.deleted_at IS NULL) AS post_count,
+			(SELECT COUNT(*) FROM thread_reactions WHERE thread_reactions.thread_id = threads.id) AS reaction_count,
+			last_post.created_at AS last_post_at,
+			last_post.user_id AS last_post_user_id,
+			COALESCE(last_post.created_at, threads.created_at) AS last_activity_at`).
+		Joins(`LEFT JOIN LATERAL (
+			SELECT posts.user_id, posts.created_at FROM posts
+			WHERE posts.thread_id = threads.id AND posts.deleted_at IS NULL
+			ORDER BY posts.created_at DESC LIMIT 1
+		) last_post ON true`).
+		Scopes(filter).
+		Order(order).
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Scan(&threads).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch threads"})
 		return
 	}
 
-	c.JSON(http.StatusOK, threads)
+	if err := hydrateThreadSummaries(threads); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch threads"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"threads":  threads,
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+		"has_more": int64(page*limit) < total,
+	})
+}
+
+// hydrateThreadSummaries attaches authors and per-emoji reaction counts using
+// one query each instead of one per thread.
+func hydrateThreadSummaries(threads []ThreadSummary) error {
+	if len(threads) == 0 {
+		return nil
+	}
+
+	threadIDs := make([]uint, 0, len(threads))
+	userIDs := make([]uint, 0, len(threads)*2)
+	for _, thread := range threads {
+		threadIDs = append(threadIDs, thread.ID)
+		userIDs = append(userIDs, thread.UserID)
+		if thread.LastPostUserID != nil {
+			userIDs = append(userIDs, *thread.LastPostUserID)
+		}
+	}
+
+	var users []models.User
+	if err := database.DB.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return err
+	}
+	usersByID := make(map[uint]models.User, len(users))
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	var counts []struct {
+		ThreadID uint
+		Emoji    string
+		Count    int
+	}
+	if err := database.DB.Model(&models.ThreadReaction{}).
+		Select("thread_id, emoji, COUNT(*) AS count").
+		Where("thread_id IN ?", threadIDs).
+		Group("thread_id, emoji").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+	countsByThread := make(map[uint]map[string]int, len(threads))
+	for _, row := range counts {
+		if countsByThread[row.ThreadID] == nil {
+			countsByThread[row.ThreadID] = make(map[string]int)
+		}
+		countsByThread[row.ThreadID][row.Emoji] = row.Count
+	}
+
+	for i := range threads {
+		threads[i].User = usersByID[threads[i].UserID]
+		if threads[i].LastPostUserID != nil {
+			user := usersByID[*threads[i].LastPostUserID]
+			threads[i].LastPostUser = &user
+		}
+		threads[i].ReactionCounts = countsByThread[threads[i].ID]
+		if threads[i].ReactionCounts == nil {
+			threads[i].ReactionCounts = map[string]int{}
+		}
+	}
+
+	return nil
 }
 
 func CreatePost(c *gin.Context) {
@@ -148,12 +294,18 @@ func CreatePost(c *gin.Context) {
 		return
 	}
 
+	if thread.DeletedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Thread has been deleted"})
+		return
+	}
+
 	userID := c.GetUint("user_id")
 
 	post := models.Post{
 		Content:  req.Content,
 		ThreadID: uint(threadID),
 		UserID:   userID,
+		Bot:      c.GetBool("bot"),
 	}
 
 	if err := database.DB.Create(&post).Error; err != nil {
@@ -165,3 +317,266 @@ func CreatePost(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, post)
 }
+
+const DeletedPlaceholder = "[deleted]"
+
+func canModifyForumContent(c *gin.Context, authorID uint) bool {
+	return c.GetUint("user_id") == authorID || middleware.Can(c, middleware.PermForumModerate)
+}
+
+// loadThreadPost fetches the post named by :postId and checks it belongs to
+// the thread named by :id.
+func loadThreadPost(c *gin.Context) (*models.Post, bool) {
+	threadID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid thread id"})
+		return nil, false
+	}
+
+	postID, err := strconv.Atoi(c.Param("postId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid post id"})
+		return nil, false
+	}
+
+	var post models.Post
+	if err := database.DB.Where("id = ? AND thread_id = ?", postID, threadID).First(&post).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+		return nil, false
+	}
+
+	return &post, true
+}
+
+func UpdateThread(c *gin.Context) {
+	var thread models.Thread
+	if err := database.DB.First(&thread, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thread not found"})
+		return
+	}
+
+	if !canModifyForumContent(c, thread.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot edit this thread"})
+		return
+	}
+
+	if thread.DeletedAt != nil {
+		c.JSON(http.StatusGone, gin.H{"error": "Thread has been deleted"})
+		return
+	}
+
+	var req struct {
+		Title string `json:"title" binding:"required,min=3,max=200"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Model(&thread).Updates(map[string]interface{}{
+		"title":     req.Title,
+		"edited_at": time.Now(),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update thread"})
+		return
+	}
+
+	database.DB.Preload("User").First(&thread, thread.ID)
+
+	c.JSON(http.StatusOK, thread)
+}
+
+// DeleteThread soft-deletes a thread: it drops out of listings but links to it
+// keep resolving to a "[deleted]" placeholder with its replies intact. The
+// opening post is scrubbed like DeletePost does and the images are dropped.
+func DeleteThread(c *gin.Context) {
+	var thread models.Thread
+	if err := database.DB.First(&thread, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thread not found"})
+		return
+	}
+
+	if !canModifyForumContent(c, thread.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot delete this thread"})
+		return
+	}
+
+	if thread.DeletedAt != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Thread already deleted"})
+		return
+	}
+
+	// The opening post is the thread's body, so it goes with the thread, along
+	// with its revisions and the thread's images. Replies stay.
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var opening models.Post
+		err := tx.Where("thread_id = ?", thread.ID).Order("id ASC").First(&opening).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		// A thread created without content has no opening post; its first
+		// post is then a reply, unless the author wrote it.
+		if err == nil && opening.UserID == thread.UserID {
+			if err := tx.Where("post_id = ?", opening.ID).Delete(&models.PostRevision{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&opening).Updates(map[string]interface{}{
+				"content":    DeletedPlaceholder,
+				"deleted_at": time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("thread_id = ?", thread.ID).Delete(&models.ThreadImage{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&thread).Updates(map[string]interface{}{
+			"title":      DeletedPlaceholder,
+			"deleted_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete thread"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Thread deleted successfully"})
+}
+
+func UpdatePost(c *gin.Context) {
+	post, ok := loadThreadPost(c)
+	if !ok {
+		return
+	}
+
+	if !canModifyForumContent(c, post.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot edit this post"})
+		return
+	}
+
+	var req struct {
+		Content string `json:"content" binding:"required,min=1"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The post is re-read under a row lock so a concurrent edit or delete
+	// can't slip between the revision snapshot and the update.
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(post, post.ID).Error; err != nil {
+			return err
+		}
+		if post.DeletedAt != nil {
+			return errPostDeleted
+		}
+
+		var thread models.Thread
+		if err := tx.Select("id", "deleted_at").First(&thread, post.ThreadID).Error; err != nil {
+			return err
+		}
+		if thread.DeletedAt != nil {
+			return errThreadDeleted
+		}
+
+		if req.Content == post.Content {
+			return nil
+		}
+
+		revision := models.PostRevision{
+			PostID:   post.ID,
+			Content:  post.Content,
+			EditedBy: c.GetUint("user_id"),
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(post).Updates(map[string]interface{}{
+			"content":   req.Content,
+			"edited_at": time.Now(),
+		}).Error
+	})
+	switch {
+	case errors.Is(err, errPostDeleted):
+		c.JSON(http.StatusGone, gin.H{"error": "Post has been deleted"})
+		return
+	case errors.Is(err, errThreadDeleted):
+		c.JSON(http.StatusGone, gin.H{"error": "Thread has been deleted"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update post"})
+		return
+	}
+
+	database.DB.Preload("User").First(post, post.ID)
+
+	c.JSON(http.StatusOK, post)
+}
+
+// DeletePost replaces the post body with a placeholder and drops its
+// revisions, so deleting is also the way to scrub something pasted by mistake.
+func DeletePost(c *gin.Context) {
+	post, ok := loadThreadPost(c)
+	if !ok {
+		return
+	}
+
+	if !canModifyForumContent(c, post.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot delete this post"})
+		return
+	}
+
+	if post.DeletedAt != nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Post already deleted"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("post_id = ?", post.ID).Delete(&models.PostRevision{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(post).Updates(map[string]interface{}{
+			"content":    DeletedPlaceholder,
+			"deleted_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete post"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
+}
+
+func GetPostRevisions(c *gin.Context) {
+	post, ok := loadThreadPost(c)
+	if !ok {
+		return
+	}
+
+	if !canModifyForumContent(c, post.UserID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot view revisions of this post"})
+		return
+	}
+
+	var revisions []models.PostRevision
+	if err := database.DB.Where("post_id = ?", post.ID).
+		Preload("Editor").
+		Order("created_at DESC").
+		Find(&revisions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"post":      post,
+		"revisions": revisions,
+	})
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/game"
+	"github.com/rj-2006/techtalk/internal/models"
+)
+
+const replayBatchSize = 500
+
+// SaveReplayEvents appends a match's replay events to its log. It is
+// installed as GameServer.Replay.
+func SaveReplayEvents(roomID uint, events []game.ReplayEvent) {
+	entries := make([]models.ReplayEntry, len(events))
+	for i, event := range events {
+		entries[i] = models.ReplayEntry{
+			GameRoomID: roomID,
+			Tick:       event.Tick,
+			Kind:       event.Kind,
+			PlayerID:   event.PlayerID,
+			Data:       string(event.Data),
+		}
+	}
+	if err := database.DB.CreateInBatches(&entries, replayBatchSize).Error; err != nil {
+		log.Printf("Failed to save replay for game %d: %v", roomID, err)
+	}
+}
+
+// replayHeader is the first line of a replay stream.
+type replayHeader struct {
+	GameRoomID uint                    `json:"game_room_id"`
+	Name       string                  `json:"name"`
+	GameType   string                  `json:"game_type"`
+	TickRate   int                     `json:"tick_rate"`
+	StartedAt  *time.Time              `json:"started_at"`
+	Players    []models.GameRoomPlayer `json:"players"`
+	Format     []string                `json:"format"`
+}
+
+// GetGameReplay streams a finished match's replay log as newline-delimited
+// JSON. The first line is a header; every following line is a compact
+// [tick, kind, player_id, data] array, in log order. Kind is "i" for an
+// accepted input and "s" for a full state snapshot. Clients choose the
+// playback speed by scheduling entries from their tick and the tick rate.
+func GetGameReplay(c *gin.Context) {
+	roomID, ok := gameRoomParam(c)
+	if !ok {
+		return
+	}
+
+	room, err := loadGameRoom(roomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game room not found"})
+		return
+	}
+
+	// In-progress matches are not replayable, so a replay can't be used to
+	// watch opponents live.
+	if room.Status != models.GameStatusFinished {
+		c.JSON(http.StatusConflict, gin.H{"error": "Replay is available once the game has finished"})
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.ReplayEntry{}).Where("game_room_id = ?", room.ID).Count(&count)
+	if count == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No replay recorded for this game"})
+		return
+	}
+
+	tickRate := 0
+	if def, ok := game.Lookup(room.GameType); ok {
+		tickRate = def.TickRate
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	if err := encoder.Encode(replayHeader{
+		GameRoomID: room.ID,
+		Name:       room.Name,
+		GameType:   room.GameType,
+		TickRate:   tickRate,
+		StartedAt:  room.StartedAt,
+		Players:    room.Players,
+		Format:     []string{"tick", "kind", "player_id", "data"},
+	}); err != nil {
+		return
+	}
+
+	var lastID uint
+	for {
+		var entries []models.ReplayEntry
+		if err := database.DB.Where("game_room_id = ? AND id > ?", room.ID, lastID).
+			Order("id ASC").
+			Limit(replayBatchSize).
+			Find(&entries).Error; err != nil {
+			log.Printf("Failed to read replay for game %d: %v", room.ID, err)
+			return
+		}
+
+		for _, entry := range entries {
+			line := []interface{}{entry.Tick, entry.Kind, entry.PlayerID, json.RawMessage(entry.Data)}
+			if err := encoder.Encode(line); err != nil {
+				return
+			}
+			lastID = entry.ID
+		}
+		c.Writer.Flush()
+
+		if len(entries) < replayBatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/game"
+	"github.com/rj-2006/techtalk/internal/models"
+	ws "github.com/rj-2006/techtalk/internal/websocket"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GameHub carries game connections. Snapshots go straight from the match to
+// each client, so the hub is mostly there for connection lifecycle and game
+// room chat.
+var GameHub *ws.Hub
+
+var GameServer *game.Manager
+
+const MaxGameChatLength = 500
+
+func gameHubRoom(roomID uint) string {
+	return "game:" + strconv.Itoa(int(roomID))
+}
+
+// gameSpectatorRoom is the hub room a game's spectators share, apart from its
+// players so the two chats stay separate.
+func gameSpectatorRoom(roomID uint) string {
+	return gameHubRoom(roomID) + ":spectators"
+}
+
+// spectatorCount is the number of distinct users watching a game, across all
+// nodes.
+func spectatorCount(roomID uint) int {
+	return GameHub.GetRoomClients(gameSpectatorRoom(roomID))
+}
+
+// SaveGameCheckpoint stores a match's state so it can be resumed after a
+// restart. It is installed as GameServer.Checkpoint.
+func SaveGameCheckpoint(roomID uint, tick uint64, state []byte) {
+	checkpoint := models.GameState{GameRoomID: roomID, StateData: string(state), Tick: tick}
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "game_room_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"state_data", "tick", "updated_at"}),
+	}).Create(&checkpoint).Error; err != nil {
+		log.Printf("Failed to checkpoint game %d: %v", roomID, err)
+	}
+}
+
+// FinishGame marks a room finished once its match ends and records the
+// result and rating changes. It is installed as GameServer.OnFinish.
+func FinishGame(roomID uint, gameType string, results []game.Result, state []byte) {
+	if err := recordMatchResult(roomID, gameType, results); err != nil {
+		log.Printf("Failed to record result for game %d: %v", roomID, err)
+	}
+}
+
+// startMatch runs the room's match on this server, resuming from its last
+// checkpoint if there is one.
+func startMatch(room *models.GameRoom) (*game.Match, error) {
+	if match := GameServer.Get(room.ID); match != nil {
+		return match, nil
+	}
+
+	var players []models.GameRoomPlayer
+	if err := database.DB.Where("game_room_id = ?", room.ID).Order("seat ASC").Find(&players).Error; err != nil {
+		return nil, err
+	}
+	playerIDs := make([]uint, len(players))
+	for i, player := range players {
+		playerIDs[i] = player.UserID
+	}
+
+	var checkpoint []byte
+	var state models.GameState
+	err := database.DB.Where("game_room_id = ?", room.ID).First(&state).Error
+	switch {
+	case err == nil:
+		checkpoint = []byte(state.StateData)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	return GameServer.Start(room.ID, room.GameType, playerIDs, checkpoint, state.Tick)
+}
+
+// ResumeGames restarts every match that was still playing when the server
+// stopped.
+func ResumeGames() error {
+	var rooms []models.GameRoom
+	if err := database.DB.Where("status = ?", models.GameStatusPlaying).Find(&rooms).Error; err != nil {
+		return err
+	}
+
+	for i := range rooms {
+		if _, err := startMatch(&rooms[i]); err != nil {
+			log.Printf("Failed to resume game %d: %v", rooms[i].ID, err)
+		}
+	}
+	return nil
+}
+
+// HandleGameWebsocket connects a user to a room's running match: as a player
+// if they have a seat, otherwise as a read-only spectator. Spectators don't
+// take a seat, so they don't count toward MaxPlayers.
+func HandleGameWebsocket(c *gin.Context) {
+	roomID, ok := gameRoomParam(c)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	var room models.GameRoom
+	if err := database.DB.First(&room, roomID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game room not found"})
+		return
+	}
+
+	var seat models.GameRoomPlayer
+	err := database.DB.Where("game_room_id = ? AND user_id = ?", room.ID, userID).First(&seat).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch game room"})
+		return
+	}
+	spectator := err != nil
+
+	if room.Status != models.GameStatusPlaying {
+		c.JSON(http.StatusConflict, gin.H{"error": "Game is not in progress"})
+		return
+	}
+
+	match, err := startMatch(&room)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start game"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Websocket upgrade failed: %v", err)
+		return
+	}
+
+	roles, _ := c.Get("roles")
+	roleNames, _ := roles.([]string)
+
+	hubRoom := gameHubRoom(room.ID)
+	if spectator {
+		hubRoom = gameSpectatorRoom(room.ID)
+	}
+
+	client := ws.NewClient(GameHub, conn, hubRoom, userID, c.GetString("username"), roleNames)
+	GameHub.Register <- client
+	if spectator {
+		match.Watch(client)
+	} else {
+		match.Join(client)
+	}
+
+	go client.WritePump()
+	go handleGameMessages(client, match, spectator)
+}
+
+func handleGameMessages(client *ws.Client, match *game.Match, spectator bool) {
+	defer func() {
+		if spectator {
+			match.Unwatch(client)
+		} else {
+			match.Leave(client)
+		}
+		client.Hub.Unregister <- client
+		client.Conn.Close()
+	}()
+
+	client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	client.Conn.SetReadLimit(64 * 1024)
+	client.Conn.SetPongHandler(func(string) error {
+		client.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+
+	for {
+		_, message, err := client.Conn.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		var msg ws.IncomingMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case ws.MessageTypeGameMove:
+			if spectator {
+				sendError(client, "Spectators cannot make moves")
+				continue
+			}
+			if len(msg.Payload) == 0 {
+				sendError(client, "Invalid move payload")
+				continue
+			}
+
+			// The engine decodes the payload; the player is always the
+			// connection's user, whatever the payload claims.
+			match.Submit(client.UserID, msg.Payload)
+
+		case ws.MessageTypeChat, ws.MessageTypeSendChat:
+			content := msg.Content
+			if content == "" && len(msg.Payload) > 0 {
+				var payload ws.ChatMessage
+				if err := json.Unmarshal(msg.Payload, &payload); err == nil {
+					content = payload.Content
+				}
+			}
+			content = strings.TrimSpace(content)
+			if content == "" {
+				continue
+			}
+			if len(content) > MaxGameChatLength {
+				sendError(client, "Message too long")
+				continue
+			}
+
+			// Chat goes to the sender's own hub room, so players and
+			// spectators never see each other's messages.
+			data, _ := json.Marshal(ws.Event{
+				Type: ws.EventTypeGameChat,
+				Payload: ws.GameChatMessage{
+					UserID:    client.UserID,
+					Username:  client.Username,
+					Content:   content,
+					Spectator: spectator,
+					Timestamp: time.Now().Unix(),
+				},
+			})
+			client.Hub.Broadcast <- &ws.BroadcastMessage{
+				RoomID:  client.RoomID,
+				Message: data,
+				Sender:  client,
+			}
+		}
+	}
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/game"
+	"github.com/rj-2006/techtalk/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errGameNotFound   = errors.New("game room not found")
+	errGameNotWaiting = errors.New("game has already started")
+	errGameFull       = errors.New("game room is full")
+	errNotInGame      = errors.New("you are not in this game room")
+)
+
+func gameErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errGameNotFound), errors.Is(err, errNotInGame):
+		return http.StatusNotFound
+	case errors.Is(err, errGameNotWaiting), errors.Is(err, errGameFull):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// lockGameRoom loads a game room with SELECT ... FOR UPDATE, serialising
+// every seat change for that room behind the transaction.
+func lockGameRoom(tx *gorm.DB, roomID uint) (*models.GameRoom, error) {
+	var room models.GameRoom
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&room, roomID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errGameNotFound
+		}
+		return nil, err
+	}
+	return &room, nil
+}
+
+// takeSeat puts the user in the lowest free seat. The caller must hold the
+// room lock. Joining a room the user is already in returns their seat.
+func takeSeat(tx *gorm.DB, room *models.GameRoom, userID uint) (*models.GameRoomPlayer, error) {
+	var players []models.GameRoomPlayer
+	if err := tx.Where("game_room_id = ?", room.ID).Order("seat ASC").Find(&players).Error; err != nil {
+		return nil, err
+	}
+
+	for _, player := range players {
+		if player.UserID == userID {
+			return &player, nil
+		}
+	}
+
+	if room.Status != models.GameStatusWaiting {
+		return nil, errGameNotWaiting
+	}
+	if len(players) >= room.MaxPlayers {
+		return nil, errGameFull
+	}
+
+	seat := 0
+	for _, player := range players {
+		if player.Seat != seat {
+			break
+		}
+		seat++
+	}
+
+	player := models.GameRoomPlayer{GameRoomID: room.ID, UserID: userID, Seat: seat}
+	if err := tx.Create(&player).Error; err != nil {
+		return nil, err
+	}
+	return &player, nil
+}
+
+func loadGameRoom(roomID uint) (*models.GameRoom, error) {
+	var room models.GameRoom
+	err := database.DB.Preload("Players", func(db *gorm.DB) *gorm.DB {
+		return db.Order("seat ASC")
+	}).Preload("Players.User").First(&room, roomID).Error
+	return &room, err
+}
+
+func gameRoomParam(c *gin.Context) (uint, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid game room ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondGameRoom writes the room with its seats, or the error if the
+// preceding transaction failed.
+func respondGameRoom(c *gin.Context, roomID uint, err error) {
+	if err != nil {
+		c.JSON(gameErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	room, err := loadGameRoom(roomID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch game room"})
+		return
+	}
+	c.JSON(http.StatusOK, room)
+}
+
+func CreateGameRoom(c *gin.Context) {
+	var req struct {
+		Name       string `json:"name" binding:"required,min=3,max=100"`
+		GameType   string `json:"game_type" binding:"required"`
+		MaxPlayers int    `json:"max_players"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	def, ok := game.Lookup(req.GameType)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported game type"})
+		return
+	}
+
+	if req.MaxPlayers == 0 {
+		req.MaxPlayers = def.MaxPlayers
+	}
+	if req.MaxPlayers < def.MinPlayers || req.MaxPlayers > def.MaxPlayers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("max_players must be between %d and %d for %s",
+			def.MinPlayers, def.MaxPlayers, def.Name)})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	room := models.GameRoom{
+		Name:       req.Name,
+		GameType:   req.GameType,
+		MaxPlayers: req.MaxPlayers,
+		Status:     models.GameStatusWaiting,
+		CreatedBy:  userID,
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&room).Error; err != nil {
+			return err
+		}
+		_, err := takeSeat(tx, &room, userID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create game room"})
+		return
+	}
+
+	created, err := loadGameRoom(room.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch game room"})
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+const (
+	DefaultGameRoomPageSize = 20
+	MaxGameRoomPageSize     = 50
+)
+
+// GetGameRooms lists game rooms a page at a time, newest first, optionally
+// filtered by ?status= and ?game_type=.
+func GetGameRooms(c *gin.Context) {
+	page, limit, ok := pageParams(c, DefaultGameRoomPageSize, MaxGameRoomPageSize)
+	if !ok {
+		return
+	}
+
+	query := database.DB.Model(&models.GameRoom{})
+
+	if status := c.Query("status"); status != "" {
+		if status != models.GameStatusWaiting && status != models.GameStatusPlaying && status != models.GameStatusFinished {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status (waiting, playing, finished)"})
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+	if gameType := c.Query("game_type"); gameType != "" {
+		query = query.Where("game_type = ?", gameType)
+	}
+
+	// A fresh session per use so the count doesn't leak into the find.
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch game rooms"})
+		return
+	}
+
+	var rooms []models.GameRoom
+	if err := query.Preload("Players", func(db *gorm.DB) *gorm.DB {
+		return db.Order("seat ASC")
+	}).Preload("Players.User").
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch game rooms"})
+		return
+	}
+
+	type GameRoomListing struct {
+		models.GameRoom
+		PlayerCount    int `json:"player_count"`
+		SpectatorCount int `json:"spectator_count"`
+	}
+
+	result := make([]GameRoomListing, len(rooms))
+	for i, room := range rooms {
+		result[i] = GameRoomListing{
+			GameRoom:       room,
+			PlayerCount:    len(room.Players),
+			SpectatorCount: spectatorCount(room.ID),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rooms":    result,
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+		"has_more": int64(page*limit) < total,
+	})
+}
+
+// GetGameTypes lists the game types rooms can be created for.
+func GetGameTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, game.Definitions())
+}
+
+func GetGameRoom(c *gin.Context) {
+	roomID, ok := gameRoomParam(c)
+	if !ok {
+		return
+	}
+
+	room, err := loadGameRoom(roomID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game room not found"})
+		return
+	}
+	c.JSON(http.StatusOK, room)
+}
+
+// JoinGameRoom seats the caller. The room row is locked for the duration, so
+// concurrent joins cannot push a room past MaxPlayers.
+func JoinGameRoom(c *gin.Context) {
+	roomID, ok := gameRoomParam(c)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		room, err := lockGameRoom(tx, roomID)
+		if err != nil {
+			return err
+		}
+		_, err = takeSeat(tx, room, userID)
+		return err
+	})
+
+	respondGameRoom(c, roomID, err)
+}
+
+// LeaveGameRoom frees the caller's seat. A waiting room left empty is closed.
+func LeaveGameRoom(c *gin.Context) {
+	roomID, ok := gameRoomParam(c)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		room, err := lockGameRoom(tx, roomID)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("game_room_id = ? AND user_id = ?", room.ID, userID).Delete(&models.GameRoomPlayer{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNotInGame
+		}
+
+		if room.Status != models.GameStatusWaiting {
+			return nil
+		}
+
+		var remaining int64
+		if err := tx.Model(&models.GameRoomPlayer{}).Where("game_room_id = ?", room.ID).Count(&remaining).Error; err != nil {
+			return err
+		}
+		if remaining == 0 {
+			return tx.Model(room).Update("status", models.GameStatusFinished).Error
+		}
+		return nil
+	})
+
+	respondGameRoom(c, roomID, err)
+}
+
+// SetGameReady marks the caller ready (or not, with {"ready": false}). Once
+// the game type's minimum number of players are seated and all of them are
+// ready, the room moves from waiting to playing.
+func SetGameReady(c *gin.Context) {
+	roomID, ok := gameRoomParam(c)
+	if !ok {
+		return
+	}
+	userID := c.GetUint("user_id")
+
+	var req struct {
+		Ready *bool `json:"ready"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	ready := req.Ready == nil || *req.Ready
+
+	var started *models.GameRoom
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		room, err := lockGameRoom(tx, roomID)
+		if err != nil {
+			return err
+		}
+		if room.Status != models.GameStatusWaiting {
+			return errGameNotWaiting
+		}
+
+		result := tx.Model(&models.GameRoomPlayer{}).
+			Where("game_room_id = ? AND user_id = ?", room.ID, userID).
+			Update("ready", ready)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errNotInGame
+		}
+
+		var players []models.GameRoomPlayer
+		if err := tx.Where("game_room_id = ?", room.ID).Find(&players).Error; err != nil {
+			return err
+		}
+		def, ok := game.Lookup(room.GameType)
+		if !ok {
+			return game.ErrUnsupportedGame
+		}
+		if len(players) < def.MinPlayers {
+			return nil
+		}
+		for _, player := range players {
+			if !player.Ready {
+				return nil
+			}
+		}
+
+		if err := tx.Model(room).Updates(map[string]interface{}{
+			"status":     models.GameStatusPlaying,
+			"started_at": time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+		started = room
+		return nil
+	})
+
+	if err == nil && started != nil {
+		if _, err := startMatch(started); err != nil {
+			log.Printf("Failed to start game %d: %v", started.ID, err)
+			// Put the room back in the lobby so it isn't left "playing"
+			// with no match running.
+			if err := database.DB.Model(&models.GameRoom{}).
+				Where("id = ? AND status = ?", started.ID, models.GameStatusPlaying).
+				Updates(map[string]interface{}{
+					"status":     models.GameStatusWaiting,
+					"started_at": nil,
+				}).Error; err != nil {
+				log.Printf("Failed to reset game %d: %v", started.ID, err)
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start game"})
+			return
+		}
+	}
+
+	respondGameRoom(c, roomID, err)
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/middleware"
+	"github.com/rj-2006/techtalk/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errInviteUnavailable = errors.New("invite is invalid, expired or used up")
+
+func isValidVisibility(visibility string) bool {
+	return visibility == models.ChatroomPublic ||
+		visibility == models.ChatroomInviteOnly ||
+		visibility == models.ChatroomPrivate
+}
+
+// visibleRooms limits a chatrooms query to rooms the user may see in listings:
+// public and invite-only rooms plus every room they belong to.
+func visibleRooms(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`chatrooms.visibility IN ? OR EXISTS (
+			SELECT 1 FROM chatroom_members
+			WHERE chatroom_members.chatroom_id = chatrooms.id AND chatroom_members.user_id = ?)`,
+			[]string{models.ChatroomPublic, models.ChatroomInviteOnly}, userID)
+	}
+}
+
+// roomRole returns the caller's role in a room, or "" if they are not a member.
+// Rooms created before memberships existed still treat their creator as owner.
+func roomRole(room *models.Chatroom, userID uint) string {
+	var member models.ChatroomMember
+	if err := database.DB.Where("chatroom_id = ? AND user_id = ?", room.ID, userID).
+		First(&member).Error; err == nil {
+		return member.Role
+	}
+	if room.CreatedBy == userID {
+		return models.ChatroomRoleOwner
+	}
+	return ""
+}
+
+func canReadRoom(room *models.Chatroom, userID uint) bool {
+	return room.Visibility == models.ChatroomPublic || roomRole(room, userID) != ""
+}
+
+func isRoomModerator(room *models.Chatroom, userID uint) bool {
+	role := roomRole(room, userID)
+	return role == models.ChatroomRoleOwner || role == models.ChatroomRoleModerator
+}
+
+func canManageRoom(c *gin.Context, room *models.Chatroom) bool {
+	return isRoomModerator(room, c.GetUint("user_id")) || middleware.Can(c, middleware.PermChatModerate)
+}
+
+// accessibleRoom loads a room the caller is allowed to read, writing the
+// error response and returning false otherwise.
+func accessibleRoom(c *gin.Context, roomID uint) (*models.Chatroom, bool) {
+	var room models.Chatroom
+	if err := database.DB.First(&room, roomID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chatroom not found"})
+		return nil, false
+	}
+
+	if !canReadRoom(&room, c.GetUint("user_id")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this chatroom"})
+		return nil, false
+	}
+
+	return &room, true
+}
+
+func loadRoomParam(c *gin.Context) (*models.Chatroom, bool) {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid RoomID"})
+		return nil, false
+	}
+
+	var room models.Chatroom
+	if err := database.DB.First(&room, roomID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chatroom not found"})
+		return nil, false
+	}
+
+	return &room, true
+}
+
+func addRoomMember(tx *gorm.DB, roomID, userID uint, role string) (bool, error) {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.ChatroomMember{
+		ChatroomID: roomID,
+		UserID:     userID,
+		Role:       role,
+	})
+	return result.RowsAffected > 0, result.Error
+}
+
+func JoinChatroom(c *gin.Context) {
+	room, ok := loadRoomParam(c)
+	if !ok {
+		return
+	}
+
+	if room.Visibility != models.ChatroomPublic {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This chatroom requires an invite"})
+		return
+	}
+
+	if _, err := addRoomMember(database.DB, room.ID, c.GetUint("user_id"), models.ChatroomRoleMember); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join chatroom"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Joined chatroom", "chatroom": room})
+}
+
+func LeaveChatroom(c *gin.Context) {
+	room, ok := loadRoomParam(c)
+	if !ok {
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if roomRole(room, userID) == models.ChatroomRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The owner cannot leave the chatroom"})
+		return
+	}
+
+	result := database.DB.Where("chatroom_id = ? AND user_id = ?", room.ID, userID).
+		Delete(&models.ChatroomMember{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave chatroom"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You are not a member of this chatroom"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Left chatroom"})
+}
+
+func CreateChatroomInvite(c *gin.Context) {
+	room, ok := loadRoomParam(c)
+	if !ok {
+		return
+	}
+
+	if room.Kind == models.ChatroomKindDM {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Direct messages do not support invites"})
+		return
+	}
+
+	if !canManageRoom(c, room) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only room moderators can create invites"})
+		return
+	}
+
+	var req struct {
+		ExpiresIn int `json:"expires_in" binding:"min=0"` // seconds, 0 means never
+		MaxUses   int `json:"max_uses" binding:"min=0"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	code, err := randomToken(12)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	invite := models.ChatroomInvite{
+		ChatroomID: room.ID,
+		Code:       code,
+		CreatedBy:  c.GetUint("user_id"),
+		MaxUses:    req.MaxUses,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		invite.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(&invite).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+func GetChatroomInvites(c *gin.Context) {
+	room, ok := loadRoomParam(c)
+	if !ok {
+		return
+	}
+
+	if !canManageRoom(c, room) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only room moderators can view invites"})
+		return
+	}
+
+	var invites []models.ChatroomInvite
+	if err := database.DB.Where("chatroom_id = ? AND revoked_at IS NULL", room.ID).
+		Order("created_at DESC").
+		Find(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invites"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invites)
+}
+
+func RevokeChatroomInvite(c *gin.Context) {
+	room, ok := loadRoomParam(c)
+	if !ok {
+		return
+	}
+
+	if !canManageRoom(c, room) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only room moderators can revoke invites"})
+		return
+	}
+
+	result := database.DB.Model(&models.ChatroomInvite{}).
+		Where("id = ? AND chatroom_id = ? AND revoked_at IS NULL", c.Param("inviteId"), room.ID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked"})
+}
+
+// AcceptChatroomInvite joins the caller to the invite's room. A use is only
+// consumed when the caller was not already a member.
+func AcceptChatroomInvite(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var invite models.ChatroomInvite
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("code = ?", c.Param("code")).First(&invite).Error; err != nil {
+			return errInviteUnavailable
+		}
+
+		joined, err := addRoomMember(tx, invite.ChatroomID, userID, models.ChatroomRoleMember)
+		if err != nil {
+			return err
+		}
+		if !joined {
+			return nil
+		}
+
+		result := tx.Model(&models.ChatroomInvite{}).
+			Where(`id = ? AND revoked_at IS NULL
+				AND (expires_at IS NULL OR expires_at > ?)
+				AND (max_uses = 0 OR uses < max_uses)`, invite.ID, time.Now()).
+			Update("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInviteUnavailable
+		}
+		return nil
+	})
+	if errors.Is(err, errInviteUnavailable) {
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invite"})
+		return
+	}
+
+	var room models.Chatroom
+	database.DB.First(&room, invite.ChatroomID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Joined chatroom", "chatroom": room})
+}
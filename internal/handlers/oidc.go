@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/models"
+	"github.com/rj-2006/techtalk/internal/oidc"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const OIDCStateTTL = 10 * time.Minute
+
+// oidcStateCookie binds a login's state to the browser that started it, so a
+// callback URL from someone else's login can't be replayed into it.
+const (
+	oidcStateCookie     = "oidc_state"
+	oidcStateCookiePath = "/api/auth/oidc"
+)
+
+// OIDC is the single sign-on provider, or nil if SSO is not configured.
+var OIDC *oidc.Provider
+
+var (
+	errOIDCEmailNotVerified = errors.New("the identity provider did not return a verified email")
+	errOIDCBotAccount       = errors.New("bot accounts cannot sign in")
+)
+
+// redirectToApp sends the browser back to the frontend with the result in the
+// URL fragment, which never reaches a server log.
+func redirectToApp(c *gin.Context, result url.Values) {
+	target := strings.TrimRight(AppURL, "/") + "/oidc/callback#" + result.Encode()
+	c.Redirect(http.StatusFound, target)
+}
+
+func redirectOIDCError(c *gin.Context, message string) {
+	redirectToApp(c, url.Values{"error": {message}})
+}
+
+// setOIDCStateCookie stores the state's hash for OIDCCallback to check; a
+// negative maxAge clears it. Lax still sends it on the provider's top-level
+// redirect back.
+func setOIDCStateCookie(c *gin.Context, value string, maxAge int) {
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, value, maxAge, oidcStateCookiePath, "", secure, true)
+}
+
+// OIDCLogin starts single sign-on: it saves the state, nonce and PKCE
+// verifier and redirects to the provider.
+func OIDCLogin(c *gin.Context) {
+	if OIDC == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	state, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-on"})
+		return
+	}
+	nonce, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-on"})
+		return
+	}
+	verifier, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-on"})
+		return
+	}
+
+	authURL, err := OIDC.AuthURL(c.Request.Context(), state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC discovery failed: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{})
+	record := models.OIDCLoginState{
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(OIDCStateTTL),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-on"})
+		return
+	}
+
+	setOIDCStateCookie(c, record.StateHash, int(OIDCStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback finishes single sign-on. The user is found by their linked
+// identity, else linked by verified email (reclaiming the account if its own
+// email was never verified), else provisioned; then they get the usual
+// session tokens, or a 2FA challenge if they have 2FA on.
+func OIDCCallback(c *gin.Context) {
+	if OIDC == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		redirectOIDCError(c, providerErr)
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		redirectOIDCError(c, "invalid_request")
+		return
+	}
+
+	// Only the browser that started this login may finish it.
+	stateHash := hashToken(state)
+	bound, _ := c.Cookie(oidcStateCookie)
+	if subtle.ConstantTimeCompare([]byte(bound), []byte(stateHash)) != 1 {
+		redirectOIDCError(c, "invalid_state")
+		return
+	}
+	setOIDCStateCookie(c, "", -1)
+
+	// The state is single use: whoever deletes it gets to finish the login.
+	var record models.OIDCLoginState
+	if err := database.DB.Where("state_hash = ? AND expires_at > ?", stateHash, time.Now()).
+		First(&record).Error; err != nil {
+		redirectOIDCError(c, "invalid_state")
+		return
+	}
+	if result := database.DB.Delete(&record); result.Error != nil || result.RowsAffected == 0 {
+		redirectOIDCError(c, "invalid_state")
+		return
+	}
+
+	claims, err := OIDC.Exchange(c.Request.Context(), code, record.CodeVerifier, record.Nonce)
+	if err != nil {
+		log.Printf("OIDC code exchange failed: %v", err)
+		redirectOIDCError(c, "exchange_failed")
+		return
+	}
+
+	user, err := resolveOIDCUser(claims)
+	switch {
+	case errors.Is(err, errOIDCEmailNotVerified):
+		redirectOIDCError(c, "email_not_verified")
+		return
+	case errors.Is(err, errOIDCBotAccount):
+		redirectOIDCError(c, "access_denied")
+		return
+	case err != nil:
+		log.Printf("OIDC user lookup failed: %v", err)
+		redirectOIDCError(c, "server_error")
+		return
+	}
+
+	if user.TOTPEnabledAt != nil {
+		challenge, err := startLoginChallenge(user.ID)
+		if err != nil {
+			redirectOIDCError(c, "server_error")
+			return
+		}
+		redirectToApp(c, url.Values{
+			"challenge_token": {challenge},
+			"expires_in":      {strconv.Itoa(int(LoginChallengeTTL.Seconds()))},
+		})
+		return
+	}
+
+	recordLoginSuccess(user.Email)
+	tokens, err := startSession(c, *user, false)
+	if err != nil {
+		redirectOIDCError(c, "server_error")
+		return
+	}
+	redirectToApp(c, url.Values{
+		"token":         {tokens.AccessToken},
+		"refresh_token": {tokens.RefreshToken},
+		"expires_in":    {strconv.Itoa(tokens.ExpiresIn)},
+	})
+}
+
+// resolveOIDCUser returns the user an ID token belongs to, linking or
+// creating one as needed.
+func resolveOIDCUser(claims *oidc.Claims) (*models.User, error) {
+	issuer := claims.Issuer
+
+	var identity models.UserIdentity
+	err := database.DB.Where("issuer = ? AND subject = ?", issuer, claims.Subject).First(&identity).Error
+	if err == nil {
+		var user models.User
+		if err := database.DB.First(&user, identity.UserID).Error; err != nil {
+			return nil, err
+		}
+		if user.IsBot {
+			return nil, errOIDCBotAccount
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	// Linking and provisioning both trust the email, so it has to be one the
+	// provider vouches for.
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errOIDCEmailNotVerified
+	}
+
+	var user models.User
+	provisioned, reclaimed := false, false
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("LOWER(email) = LOWER(?)", claims.Email).First(&user).Error
+		switch {
+		case err == nil:
+			if user.IsBot {
+				return errOIDCBotAccount
+			}
+			if user.EmailVerifiedAt == nil {
+				if err := reclaimUnverifiedAccount(tx, &user); err != nil {
+					return err
+				}
+				reclaimed = true
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := provisionOIDCUser(tx, claims, &user); err != nil {
+				return err
+			}
+			provisioned = true
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:  user.ID,
+			Issuer:  issuer,
+			Subject: claims.Subject,
+			Email:   claims.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if provisioned {
+		if err := assignRole(user.ID, RoleMember); err != nil {
+			return nil, err
+		}
+	}
+	if reclaimed {
+		if err := revokeUserSessions(user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// reclaimUnverifiedAccount hands an account whose email was never verified to
+// the provider-verified owner of that address. Whoever registered it may not
+// be that person (a pre-hijack), so every credential they could hold goes:
+// the password is replaced with a random one, and 2FA, recovery codes and
+// personal access tokens are removed. The caller revokes sessions once the
+// transaction commits.
+func reclaimUnverifiedAccount(tx *gorm.DB, user *models.User) error {
+	password, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Model(user).Updates(map[string]interface{}{
+		"password":          string(hashedPassword),
+		"email_verified_at": now,
+		"totp_secret":       "",
+		"totp_enabled_at":   nil,
+		"totp_last_step":    0,
+	}).Error; err != nil {
+		return err
+	}
+	user.EmailVerifiedAt = &now
+	user.TOTPEnabledAt = nil
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.LoginChallenge{}).Error; err != nil {
+		return err
+	}
+	return revokeUserTokens(tx, user.ID)
+}
+
+// provisionOIDCUser creates a user for a first SSO login. They get a random
+// password, which they can replace through the reset flow.
+func provisionOIDCUser(tx *gorm.DB, claims *oidc.Claims, user *models.User) error {
+	password, err := randomToken(32)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	username, err := availableUsername(tx, oidcUsername(claims))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	*user = models.User{
+		Username:        username,
+		Email:           claims.Email,
+		Password:        string(hashedPassword),
+		EmailVerifiedAt: &now,
+	}
+	return tx.Create(user).Error
+}
+
+// oidcUsername picks a username from the token: the preferred username, else
+// the email's local part, reduced to safe characters.
+func oidcUsername(claims *oidc.Claims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range candidate {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.' {
+			b.WriteRune(r)
+		}
+	}
+	username := b.String()
+	if len(username) > 40 {
+		username = username[:40]
+	}
+	for len(username) < 3 {
+		username += "_"
+	}
+	return username
+}
+
+// availableUsername appends a number to base until it is unused.
+func availableUsername(tx *gorm.DB, base string) (string, error) {
+	username := base
+	for i := 2; ; i++ {
+		var count int64
+		if err := tx.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return username, nil
+		}
+		username = base + strconv.Itoa(i)
+	}
+}
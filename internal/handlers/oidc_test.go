@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/models"
+	"github.com/rj-2006/techtalk/internal/oidc"
+	"github.com/rj-2006/techtalk/internal/oidc/oidctest"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// The SSO tests need a disposable Postgres database, named by the TEST_DB_*
+// variables (the same ones main reads as DB_*). They are skipped without it.
+func connectTestDB(t *testing.T) {
+	t.Helper()
+
+	name := os.Getenv("TEST_DB_NAME")
+	if name == "" {
+		t.Skip("TEST_DB_NAME not set")
+	}
+	if database.DB == nil {
+		if err := database.Connect(os.Getenv("TEST_DB_HOST"), os.Getenv("TEST_DB_USER"),
+			os.Getenv("TEST_DB_PASSWORD"), name, os.Getenv("TEST_DB_PORT")); err != nil {
+			t.Fatal(err)
+		}
+		if err := database.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		if err := SeedRoles(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+type ssoHarness struct {
+	t      *testing.T
+	issuer *oidctest.Server
+	router *gin.Engine
+}
+
+func newSSOHarness(t *testing.T) *ssoHarness {
+	connectTestDB(t)
+	t.Setenv("JWT_SECRET", "test-secret")
+	gin.SetMode(gin.TestMode)
+
+	issuer := oidctest.NewServer("techtalk")
+	t.Cleanup(issuer.Close)
+
+	previousProvider, previousAppURL := OIDC, AppURL
+	OIDC = oidc.NewProvider(oidc.Config{
+		Issuer:      issuer.URL,
+		ClientID:    "techtalk",
+		RedirectURL: "http://api.test/api/auth/oidc/callback",
+	})
+	AppURL = "http://app.test"
+	t.Cleanup(func() { OIDC, AppURL = previousProvider, previousAppURL })
+
+	router := gin.New()
+	router.GET("/api/auth/oidc/login", OIDCLogin)
+	router.GET("/api/auth/oidc/callback", OIDCCallback)
+
+	return &ssoHarness{t: t, issuer: issuer, router: router}
+}
+
+// redirect GETs target with cookies and returns where it redirects to and the
+// cookies it set.
+func (h *ssoHarness) redirect(target string, cookies ...*http.Cookie) (*url.URL, []*http.Cookie) {
+	h.t.Helper()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	h.router.ServeHTTP(w, req)
+	if w.Code != http.StatusFound {
+		h.t.Fatalf("GET %s = %d, want a redirect: %s", target, w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return location, w.Result().Cookies()
+}
+
+// startLogin runs /login and returns the code the issuer grants identity,
+// the state, and the cookies the browser would hold.
+func (h *ssoHarness) startLogin(identity oidctest.Identity) (string, string, []*http.Cookie) {
+	h.t.Helper()
+
+	location, cookies := h.redirect("/api/auth/oidc/login")
+	authURL := location.Query()
+	code := h.issuer.Authorize(identity, authURL.Get("nonce"), authURL.Get("code_challenge"))
+	return code, authURL.Get("state"), cookies
+}
+
+// finishLogin runs /callback and returns the values it hands the frontend.
+func (h *ssoHarness) finishLogin(code, state string, cookies []*http.Cookie) url.Values {
+	h.t.Helper()
+
+	callback := url.Values{"code": {code}, "state": {state}}
+	result, _ := h.redirect("/api/auth/oidc/callback?"+callback.Encode(), cookies...)
+	values, err := url.ParseQuery(result.Fragment)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return values
+}
+
+// signIn runs a full SSO login as identity in one browser.
+func (h *ssoHarness) signIn(identity oidctest.Identity) url.Values {
+	h.t.Helper()
+
+	code, state, cookies := h.startLogin(identity)
+	return h.finishLogin(code, state, cookies)
+}
+
+func uniqueIdentity() oidctest.Identity {
+	id := uuid.NewString()
+	return oidctest.Identity{
+		Subject:           "sub-" + id,
+		Email:             id + "@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "sso-" + id[:8],
+	}
+}
+
+func createTestUser(t *testing.T, email string, verified bool) (models.User, string) {
+	t.Helper()
+
+	password := "correct horse"
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Username: "local-" + uuid.NewString()[:8], Email: email, Password: string(hashed)}
+	if verified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user, password
+}
+
+func identityUser(t *testing.T, issuer, subject string) uint {
+	t.Helper()
+
+	var identity models.UserIdentity
+	if err := database.DB.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error; err != nil {
+		t.Fatalf("no identity linked for %s: %v", subject, err)
+	}
+	return identity.UserID
+}
+
+func TestOIDCProvisionsNewUser(t *testing.T) {
+	h := newSSOHarness(t)
+	identity := uniqueIdentity()
+
+	result := h.signIn(identity)
+	if result.Get("token") == "" || result.Get("refresh_token") == "" {
+		t.Fatalf("callback result = %v, want session tokens", result)
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", identity.Email).First(&user).Error; err != nil {
+		t.Fatalf("user was not provisioned: %v", err)
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("provisioned user's email is not marked verified")
+	}
+	if got := identityUser(t, h.issuer.URL, identity.Subject); got != user.ID {
+		t.Errorf("identity linked to user %d, want %d", got, user.ID)
+	}
+	roles, err := userRoleNames(user.ID)
+	if err != nil || len(roles) != 1 || roles[0] != RoleMember {
+		t.Errorf("provisioned user roles = %v (%v), want [%s]", roles, err, RoleMember)
+	}
+}
+
+func TestOIDCUsesLinkedIdentity(t *testing.T) {
+	h := newSSOHarness(t)
+	identity := uniqueIdentity()
+	h.signIn(identity)
+	userID := identityUser(t, h.issuer.URL, identity.Subject)
+
+	// The provider-side email changed; the link, not the email, decides.
+	renamed := identity
+	renamed.Email = uuid.NewString() + "@example.com"
+	result := h.signIn(renamed)
+	if result.Get("token") == "" {
+		t.Fatalf("callback result = %v, want session tokens", result)
+	}
+
+	var count int64
+	database.DB.Model(&models.User{}).Where("email = ?", renamed.Email).Count(&count)
+	if count != 0 {
+		t.Error("a second user was provisioned for a linked identity")
+	}
+	var sessions int64
+	database.DB.Model(&models.Session{}).Where("user_id = ?", userID).Count(&sessions)
+	if sessions != 2 {
+		t.Errorf("linked user has %d sessions, want 2", sessions)
+	}
+}
+
+func TestOIDCLinksVerifiedAccountByEmail(t *testing.T) {
+	h := newSSOHarness(t)
+	identity := uniqueIdentity()
+	user, password := createTestUser(t, identity.Email, true)
+
+	result := h.signIn(identity)
+	if result.Get("token") == "" {
+		t.Fatalf("callback result = %v, want session tokens", result)
+	}
+	if got := identityUser(t, h.issuer.URL, identity.Subject); got != user.ID {
+		t.Errorf("identity linked to user %d, want %d", got, user.ID)
+	}
+
+	var reloaded models.User
+	database.DB.First(&reloaded, user.ID)
+	if bcrypt.CompareHashAndPassword([]byte(reloaded.Password), []byte(password)) != nil {
+		t.Error("linking a verified account changed its password")
+	}
+}
+
+func TestOIDCReclaimsUnverifiedAccount(t *testing.T) {
+	h := newSSOHarness(t)
+	identity := uniqueIdentity()
+
+	// Someone registered the address first without being able to verify it,
+	// and left themselves a session and a token.
+	squatter, password := createTestUser(t, identity.Email, false)
+	session := models.Session{
+		ID:               uuid.NewString(),
+		UserID:           squatter.ID,
+		RefreshTokenHash: hashToken(uuid.NewString()),
+		ExpiresAt:        time.Now().Add(time.Hour),
+		LastUsedAt:       time.Now(),
+	}
+	token := models.PersonalAccessToken{
+		UserID:    squatter.ID,
+		CreatedBy: squatter.ID,
+		Name:      "squatter",
+		Prefix:    "ttp_test",
+		TokenHash: hashToken(uuid.NewString()),
+		Scopes:    []string{"read"},
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	result := h.signIn(identity)
+	if result.Get("token") == "" {
+		t.Fatalf("callback result = %v, want session tokens", result)
+	}
+	if got := identityUser(t, h.issuer.URL, identity.Subject); got != squatter.ID {
+		t.Errorf("identity linked to user %d, want %d", got, squatter.ID)
+	}
+
+	var reloaded models.User
+	database.DB.First(&reloaded, squatter.ID)
+	if reloaded.EmailVerifiedAt == nil {
+		t.Error("reclaimed account's email is not marked verified")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(reloaded.Password), []byte(password)) == nil {
+		t.Error("the squatter's password still works")
+	}
+	database.DB.First(&session, "id = ?", session.ID)
+	if session.RevokedAt == nil {
+		t.Error("the squatter's session was not revoked")
+	}
+	database.DB.First(&token, token.ID)
+	if token.RevokedAt == nil {
+		t.Error("the squatter's personal access token was not revoked")
+	}
+}
+
+func TestOIDCRejectsUnverifiedProviderEmail(t *testing.T) {
+	h := newSSOHarness(t)
+	identity := uniqueIdentity()
+	identity.EmailVerified = false
+
+	result := h.signIn(identity)
+	if got := result.Get("error"); got != "email_not_verified" {
+		t.Fatalf("callback error = %q, want email_not_verified", got)
+	}
+
+	var count int64
+	database.DB.Model(&models.User{}).Where("email = ?", identity.Email).Count(&count)
+	if count != 0 {
+		t.Error("a user was provisioned from an unverified email")
+	}
+}
+
+// A callback URL from someone else's login must not sign this browser in,
+// and must not use up the other login either.
+func TestOIDCRejectsCallbackFromAnotherBrowser(t *testing.T) {
+	h := newSSOHarness(t)
+	identity := uniqueIdentity()
+
+	code, state, cookies := h.startLogin(identity)
+	_, _, otherCookies := h.startLogin(uniqueIdentity())
+
+	for name, jar := range map[string][]*http.Cookie{"no cookie": nil, "another login's cookie": otherCookies} {
+		if got := h.finishLogin(code, state, jar).Get("error"); got != "invalid_state" {
+			t.Errorf("%s: callback error = %q, want invalid_state", name, got)
+		}
+	}
+
+	result := h.finishLogin(code, state, cookies)
+	if result.Get("token") == "" {
+		t.Fatalf("callback result = %v, want session tokens", result)
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/models"
+	ws "github.com/rj-2006/techtalk/internal/websocket"
+)
+
+const MaxPresenceLookup = 100
+
+type MemberPresence struct {
+	User       models.User `json:"user"`
+	Role       string      `json:"role,omitempty"`
+	Status     string      `json:"status"`
+	LastSeenAt *time.Time  `json:"last_seen_at,omitempty"`
+}
+
+// RecordLastSeen is installed as the hub's OnUserOffline hook.
+func RecordLastSeen(userID uint) {
+	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).
+		Update("last_seen_at", time.Now()).Error; err != nil {
+		log.Printf("Failed to record last seen for user %d: %v", userID, err)
+	}
+}
+
+func statusRank(status string) int {
+	switch status {
+	case ws.StatusOnline:
+		return 0
+	case ws.StatusIdle:
+		return 1
+	}
+	return 2
+}
+
+// GetChatroomMembers lists a room's members plus anyone currently connected
+// to it, online users first.
+func GetChatroomMembers(c *gin.Context) {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid RoomID"})
+		return
+	}
+
+	room, ok := accessibleRoom(c, uint(roomID))
+	if !ok {
+		return
+	}
+
+	var memberships []models.ChatroomMember
+	if err := database.DB.Where("chatroom_id = ?", room.ID).Preload("User").Find(&memberships).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+
+	presence := ChatHub.RoomPresence(strconv.Itoa(int(room.ID)))
+
+	members := make(map[uint]*MemberPresence, len(memberships)+len(presence))
+	for _, membership := range memberships {
+		members[membership.UserID] = &MemberPresence{
+			User:   membership.User,
+			Role:   membership.Role,
+			Status: ws.StatusOffline,
+		}
+	}
+
+	// Public rooms can be read without joining, so connected visitors are
+	// listed alongside members.
+	var visitorIDs []uint
+	for userID := range presence {
+		if _, ok := members[userID]; !ok {
+			visitorIDs = append(visitorIDs, userID)
+		}
+	}
+	if len(visitorIDs) > 0 {
+		var visitors []models.User
+		database.DB.Where("id IN ?", visitorIDs).Find(&visitors)
+		for _, user := range visitors {
+			members[user.ID] = &MemberPresence{User: user, Status: ws.StatusOffline}
+		}
+	}
+
+	result := make([]MemberPresence, 0, len(members))
+	for userID, member := range members {
+		if entry, ok := presence[userID]; ok {
+			member.Status = entry.Status
+		} else {
+			member.LastSeenAt = member.User.LastSeenAt
+		}
+		result = append(result, *member)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if statusRank(result[i].Status) != statusRank(result[j].Status) {
+			return statusRank(result[i].Status) < statusRank(result[j].Status)
+		}
+		return result[i].User.Username < result[j].User.Username
+	})
+
+	online := 0
+	for _, member := range result {
+		if member.Status != ws.StatusOffline {
+			online++
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"members": result,
+		"online":  online,
+	})
+}
+
+// GetPresence returns the global status of the users listed in ?user_ids=,
+// for online indicators outside chat (e.g. forum avatars).
+func GetPresence(c *gin.Context) {
+	raw := c.Query("user_ids")
+	if raw == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids required"})
+		return
+	}
+
+	parts := strings.Split(raw, ",")
+	if len(parts) > MaxPresenceLookup {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many user IDs"})
+		return
+	}
+
+	userIDs := make([]uint, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		userIDs = append(userIDs, uint(id))
+	}
+
+	statuses := ChatHub.UserStatuses(userIDs)
+
+	var offline []uint
+	for _, id := range userIDs {
+		if statuses[id] == ws.StatusOffline {
+			offline = append(offline, id)
+		}
+	}
+
+	lastSeen := make(map[uint]*time.Time, len(offline))
+	if len(offline) > 0 {
+		var users []models.User
+		database.DB.Select("id", "last_seen_at").Where("id IN ?", offline).Find(&users)
+		for _, user := range users {
+			lastSeen[user.ID] = user.LastSeenAt
+		}
+	}
+
+	type presenceEntry struct {
+		UserID     uint       `json:"user_id"`
+		Status     string     `json:"status"`
+		LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	}
+
+	result := make([]presenceEntry, 0, len(userIDs))
+	for _, id := range userIDs {
+		result = append(result, presenceEntry{
+			UserID:     id,
+			Status:     statuses[id],
+			LastSeenAt: lastSeen[id],
+		})
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/game"
+	"github.com/rj-2006/techtalk/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	DefaultRating = 1200.0
+	EloK          = 32.0
+
+	DefaultLeaderboardPageSize = 25
+	MaxLeaderboardPageSize     = 100
+)
+
+// pageParams reads ?page= and ?limit=, writing a 400 and returning false if
+// either is invalid.
+func pageParams(c *gin.Context, defaultLimit, maxLimit int) (int, int, bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+		return 0, 0, false
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultLimit)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return 0, 0, false
+	}
+	if limit > maxLimit {
+		limit = maxLimit
+	}
+	return page, limit, true
+}
+
+// eloChanges treats a multiplayer match as every pair of players playing each
+// other, scaling K so a player's total swing is the same however many
+// opponents they had.
+func eloChanges(ratings []float64, placements []int) []float64 {
+	changes := make([]float64, len(ratings))
+	if len(ratings) < 2 {
+		return changes
+	}
+
+	k := EloK / float64(len(ratings)-1)
+	for i := range ratings {
+		for j := range ratings {
+			if i == j {
+				continue
+			}
+			expected := 1 / (1 + math.Pow(10, (ratings[j]-ratings[i])/400))
+			actual := 0.5
+			switch {
+			case placements[i] < placements[j]:
+				actual = 1
+			case placements[i] > placements[j]:
+				actual = 0
+			}
+			changes[i] += k * (actual - expected)
+		}
+	}
+	return changes
+}
+
+// lockRatings returns the players' rating rows for a game type, creating any
+// that are missing, locked FOR UPDATE. Rows are locked in user ID order so
+// that matches finishing at the same time cannot deadlock.
+func lockRatings(tx *gorm.DB, gameType string, userIDs []uint) (map[uint]*models.PlayerRating, error) {
+	sorted := append([]uint(nil), userIDs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	missing := make([]models.PlayerRating, len(sorted))
+	for i, id := range sorted {
+		missing[i] = models.PlayerRating{UserID: id, GameType: gameType, Rating: DefaultRating}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&missing).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []models.PlayerRating
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("game_type = ? AND user_id IN ?", gameType, sorted).
+		Order("user_id ASC").
+		Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	ratings := make(map[uint]*models.PlayerRating, len(rows))
+	for i := range rows {
+		ratings[rows[i].UserID] = &rows[i]
+	}
+	return ratings, nil
+}
+
+// recordMatchResult finishes a playing room, writes its MatchResult and
+// applies the rating changes, all in one transaction. A room that is no
+// longer playing has already been recorded and is left alone.
+func recordMatchResult(roomID uint, gameType string, results []game.Result) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		room, err := lockGameRoom(tx, roomID)
+		if err != nil {
+			return err
+		}
+		if room.Status != models.GameStatusPlaying {
+			return nil
+		}
+
+		if err := tx.Model(room).Update("status", models.GameStatusFinished).Error; err != nil {
+			return err
+		}
+
+		match := models.MatchResult{GameRoomID: room.ID, GameType: gameType, FinishedAt: time.Now()}
+		if err := tx.Create(&match).Error; err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			return nil
+		}
+
+		userIDs := make([]uint, len(results))
+		for i, result := range results {
+			userIDs[i] = result.PlayerID
+		}
+		ratings, err := lockRatings(tx, gameType, userIDs)
+		if err != nil {
+			return err
+		}
+
+		before := make([]float64, len(results))
+		placements := make([]int, len(results))
+		allTied := true
+		for i, result := range results {
+			before[i] = ratings[result.PlayerID].Rating
+			placements[i] = result.Placement
+			if result.Placement != results[0].Placement {
+				allTied = false
+			}
+		}
+		changes := eloChanges(before, placements)
+
+		for i, result := range results {
+			rating := ratings[result.PlayerID]
+			rating.Rating = before[i] + changes[i]
+			rating.Games++
+			switch {
+			case allTied:
+				rating.Draws++
+			case result.Placement == 1:
+				rating.Wins++
+			default:
+				rating.Losses++
+			}
+			if err := tx.Save(rating).Error; err != nil {
+				return err
+			}
+
+			participant := models.MatchParticipant{
+				MatchResultID: match.ID,
+				UserID:        result.PlayerID,
+				Placement:     result.Placement,
+				Score:         result.Score,
+				RatingBefore:  before[i],
+				RatingAfter:   rating.Rating,
+			}
+			if err := tx.Create(&participant).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetLeaderboard ranks players of a game type by rating.
+func GetLeaderboard(c *gin.Context) {
+	gameType := c.Param("gameType")
+	if _, ok := game.Lookup(gameType); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown game type"})
+		return
+	}
+
+	page, limit, ok := pageParams(c, DefaultLeaderboardPageSize, MaxLeaderboardPageSize)
+	if !ok {
+		return
+	}
+
+	var total int64
+	if err := database.DB.Model(&models.PlayerRating{}).Where("game_type = ?", gameType).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leaderboard"})
+		return
+	}
+
+	var ratings []models.PlayerRating
+	if err := database.DB.Where("game_type = ?", gameType).
+		Preload("User").
+		Order("rating DESC, games DESC, user_id ASC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&ratings).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch leaderboard"})
+		return
+	}
+
+	type LeaderboardEntry struct {
+		Rank int `json:"rank"`
+		models.PlayerRating
+	}
+
+	entries := make([]LeaderboardEntry, len(ratings))
+	for i, rating := range ratings {
+		entries[i] = LeaderboardEntry{Rank: (page-1)*limit + i + 1, PlayerRating: rating}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"game_type": gameType,
+		"entries":   entries,
+		"page":      page,
+		"limit":     limit,
+		"total":     total,
+		"has_more":  int64(page*limit) < total,
+	})
+}
+
+// GetUserMatches lists a user's finished matches, newest first, optionally
+// for one ?game_type=.
+func GetUserMatches(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	page, limit, ok := pageParams(c, DefaultLeaderboardPageSize, MaxLeaderboardPageSize)
+	if !ok {
+		return
+	}
+
+	filter := func(db *gorm.DB) *gorm.DB {
+		db = db.Joins("JOIN match_participants ON match_participants.match_result_id = match_results.id").
+			Where("match_participants.user_id = ?", userID)
+		if gameType := c.Query("game_type"); gameType != "" {
+			db = db.Where("match_results.game_type = ?", gameType)
+		}
+		return db
+	}
+
+	var total int64
+	if err := database.DB.Model(&models.MatchResult{}).Scopes(filter).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch matches"})
+		return
+	}
+
+	var matches []models.MatchResult
+	if err := database.DB.Scopes(filter).Preload("Participants", func(db *gorm.DB) *gorm.DB {
+		return db.Order("placement ASC, user_id ASC")
+	}).Preload("Participants.User").
+		Order("match_results.finished_at DESC").
+		Offset((page - 1) * limit).
+		Limit(limit).
+		Find(&matches).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch matches"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"matches":  matches,
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+		"has_more": int64(page*limit) < total,
+	})
+}
@@ -2,16 +2,23 @@ package handlers
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rj-2006/techtalk/internal/database"
 	"github.com/rj-2006/techtalk/internal/models"
+	ws "github.com/rj-2006/techtalk/internal/websocket"
 	"gorm.io/gorm"
 )
 
+var (
+	errMessageNotFound       = errors.New("message not found")
+	errReactionNotFound      = errors.New("reaction not found")
+	errInvalidEmoji          = errors.New("invalid emoji type")
+	errInvalidReactionAction = errors.New("invalid reaction action")
+)
+
 var validEmojis = map[string]bool{
 	"❤️": true,
 	"🔥":  true,
@@ -148,7 +155,17 @@ func GetThreadReactions(c *gin.Context) {
 
 func AddMessageReactionDB(messageID, userID uint, emoji string) (*models.MessageReaction, error) {
 	if !validEmojis[emoji] {
-		return nil, fmt.Errorf("invalid emoji type")
+		return nil, errInvalidEmoji
+	}
+
+	var live int64
+	if err := database.DB.Model(&models.ChatMessage{}).
+		Where("id = ? AND deleted_at IS NULL", messageID).
+		Count(&live).Error; err != nil {
+		return nil, err
+	}
+	if live == 0 {
+		return nil, errMessageNotFound
 	}
 
 	var existing models.MessageReaction
@@ -182,8 +199,187 @@ func RemoveMessageReactionDB(messageID, userID uint, emoji string) error {
 	}
 
 	if result.RowsAffected == 0 {
-		return fmt.Errorf("reaction not found")
+		return errReactionNotFound
 	}
 
 	return nil
 }
+
+func messageReactionSummary(messageID uint) (map[string]int, map[string][]string, error) {
+	var reactions []models.MessageReaction
+	if err := database.DB.Where("message_id = ?", messageID).
+		Preload("User").
+		Order("created_at ASC").
+		Find(&reactions).Error; err != nil {
+		return nil, nil, err
+	}
+
+	emojiCounts := make(map[string]int)
+	emojiUsers := make(map[string][]string)
+
+	for _, reaction := range reactions {
+		emojiCounts[reaction.Emoji]++
+		emojiUsers[reaction.Emoji] = append(emojiUsers[reaction.Emoji], reaction.User.Username)
+	}
+
+	return emojiCounts, emojiUsers, nil
+}
+
+// applyMessageReaction adds or removes a reaction on a message in roomID and
+// broadcasts the new aggregate counts to everyone in the room.
+func applyMessageReaction(roomID, messageID, userID uint, username, emoji, action string) (*ws.ReactionUpdatedMessage, error) {
+	var message models.ChatMessage
+	if err := database.DB.Where("id = ? AND chatroom_id = ? AND deleted_at IS NULL", messageID, roomID).
+		First(&message).Error; err != nil {
+		return nil, errMessageNotFound
+	}
+
+	switch action {
+	case ws.ReactionActionAdd:
+		if _, err := AddMessageReactionDB(messageID, userID, emoji); err != nil {
+			return nil, err
+		}
+	case ws.ReactionActionRemove:
+		if err := RemoveMessageReactionDB(messageID, userID, emoji); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errInvalidReactionAction
+	}
+
+	counts, users, err := messageReactionSummary(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &ws.ReactionUpdatedMessage{
+		MessageID:   messageID,
+		UserID:      userID,
+		Username:    username,
+		Emoji:       emoji,
+		Action:      action,
+		EmojiCounts: counts,
+		EmojiUsers:  users,
+	}
+
+	broadcastEvent(strconv.Itoa(int(roomID)), ws.Event{
+		Type:    ws.EventTypeReactionUpdated,
+		Payload: update,
+	})
+
+	return update, nil
+}
+
+func parseMessageParams(c *gin.Context) (uint, uint, bool) {
+	roomID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid RoomID"})
+		return 0, 0, false
+	}
+
+	messageID, err := strconv.Atoi(c.Param("msgId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return 0, 0, false
+	}
+
+	return uint(roomID), uint(messageID), true
+}
+
+func reactionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errMessageNotFound), errors.Is(err, errReactionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errInvalidEmoji), errors.Is(err, errInvalidReactionAction):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// reactionErrorMessage is the client-facing text for an applyMessageReaction
+// error; unexpected failures are not passed through verbatim.
+func reactionErrorMessage(err error) string {
+	if reactionErrorStatus(err) == http.StatusInternalServerError {
+		return "failed to update reaction"
+	}
+	return err.Error()
+}
+
+func AddMessageReaction(c *gin.Context) {
+	roomID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	if _, ok := accessibleRoom(c, roomID); !ok {
+		return
+	}
+
+	var req struct {
+		Emoji string `json:"emoji" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	update, err := applyMessageReaction(roomID, messageID, c.GetUint("user_id"), c.GetString("username"),
+		req.Emoji, ws.ReactionActionAdd)
+	if err != nil {
+		c.JSON(reactionErrorStatus(err), gin.H{"error": reactionErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusCreated, update)
+}
+
+func RemoveMessageReaction(c *gin.Context) {
+	roomID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	if _, ok := accessibleRoom(c, roomID); !ok {
+		return
+	}
+
+	update, err := applyMessageReaction(roomID, messageID, c.GetUint("user_id"), c.GetString("username"),
+		c.Param("emoji"), ws.ReactionActionRemove)
+	if err != nil {
+		c.JSON(reactionErrorStatus(err), gin.H{"error": reactionErrorMessage(err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, update)
+}
+
+func GetMessageReactions(c *gin.Context) {
+	roomID, messageID, ok := parseMessageParams(c)
+	if !ok {
+		return
+	}
+
+	if _, ok := accessibleRoom(c, roomID); !ok {
+		return
+	}
+
+	var message models.ChatMessage
+	if err := database.DB.Where("id = ? AND chatroom_id = ?", messageID, roomID).
+		First(&message).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	counts, users, err := messageReactionSummary(messageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch reactions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message_id":   messageID,
+		"emoji_counts": counts,
+		"emoji_users":  users,
+	})
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/models"
+	ws "github.com/rj-2006/techtalk/internal/websocket"
+)
+
+// MaxReplayMessages caps how much a reconnect replays; past that the client
+// is told to refetch history.
+const MaxReplayMessages = 500
+
+const replayWriteWait = 10 * time.Second
+
+// replayMissedEvents writes everything a reconnecting client missed since
+// lastEventID straight to its connection: new messages as new_message, then
+// edits and deletions of older messages. It must run on a held client before
+// its write pump starts, and returns the newest message ID it replayed.
+func replayMissedEvents(client *ws.Client, roomID, lastEventID uint) (uint, error) {
+	var missed []models.ChatMessage
+	if err := database.DB.Where("chatroom_id = ? AND id > ?", roomID, lastEventID).
+		Preload("User").
+		Preload("Reactions").
+		Order("id ASC").
+		Limit(MaxReplayMessages + 1).
+		Find(&missed).Error; err != nil {
+		return lastEventID, err
+	}
+
+	truncated := len(missed) > MaxReplayMessages
+	if truncated {
+		missed = missed[:MaxReplayMessages]
+	}
+
+	newest := lastEventID
+	for _, message := range missed {
+		if err := writeReplayEvent(client, ws.Event{
+			Type:    ws.EventTypeNewMessage,
+			EventID: message.ID,
+			Payload: outgoingChatMessage(message),
+		}); err != nil {
+			return newest, err
+		}
+		newest = message.ID
+	}
+
+	if !truncated {
+		if err := replayChangedMessages(client, roomID, lastEventID); err != nil {
+			return newest, err
+		}
+	}
+
+	return newest, writeReplayEvent(client, ws.Event{
+		Type: ws.EventTypeReplayComplete,
+		Payload: ws.ReplayCompleteMessage{
+			LastEventID: newest,
+			Replayed:    len(missed),
+			Truncated:   truncated,
+		},
+	})
+}
+
+// replayChangedMessages resends edits and deletions made since the client's
+// last event to messages it had already received.
+func replayChangedMessages(client *ws.Client, roomID, lastEventID uint) error {
+	var last models.ChatMessage
+	if err := database.DB.Select("id", "created_at").
+		Where("id = ? AND chatroom_id = ?", lastEventID, roomID).
+		First(&last).Error; err != nil {
+		// Unknown cursor: nothing to compare against.
+		return nil
+	}
+
+	var changed []models.ChatMessage
+	if err := database.DB.Where("chatroom_id = ? AND id <= ?", roomID, lastEventID).
+		Where("edited_at > ? OR deleted_at > ?", last.CreatedAt, last.CreatedAt).
+		Preload("User").
+		Preload("Reactions").
+		Order("id ASC").
+		Limit(MaxReplayMessages).
+		Find(&changed).Error; err != nil {
+		return err
+	}
+
+	for _, message := range changed {
+		event := ws.Event{
+			Type:    ws.EventTypeMessageEdited,
+			Payload: outgoingChatMessage(message),
+		}
+		if message.DeletedAt != nil {
+			event = ws.Event{
+				Type: ws.EventTypeMessageDeleted,
+				Payload: ws.MessageDeletedMessage{
+					MessageID:  message.ID,
+					ChatroomID: message.ChatroomID,
+					DeletedAt:  message.DeletedAt.Format(time.RFC3339),
+				},
+			}
+		}
+		if err := writeReplayEvent(client, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeReplayEvent(client *ws.Client, event ws.Event) error {
+	data, _ := json.Marshal(event)
+	client.Conn.SetWriteDeadline(time.Now().Add(replayWriteWait))
+	return client.Conn.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/middleware"
+	"github.com/rj-2006/techtalk/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+var defaultRoles = []struct {
+	Name        string
+	Description string
+	Permissions []string
+}{
+	{RoleAdmin, "Full access to every feature", []string{middleware.PermAll}},
+	{RoleModerator, "Moderates forum threads and chatrooms", []string{middleware.PermForumModerate, middleware.PermChatModerate}},
+	{RoleMember, "Regular community member", nil},
+}
+
+// SeedRoles makes sure the built-in roles exist and loads the role cache used
+// by middleware.RequirePermission.
+func SeedRoles() error {
+	for _, def := range defaultRoles {
+		role := models.Role{Name: def.Name}
+		if err := database.DB.Where("name = ?", def.Name).
+			Attrs(models.Role{Description: def.Description, BuiltIn: true}).
+			FirstOrCreate(&role).Error; err != nil {
+			return err
+		}
+
+		var count int64
+		database.DB.Table("role_permissions").Where("role_id = ?", role.ID).Count(&count)
+		if count == 0 && len(def.Permissions) > 0 {
+			perms, err := findOrCreatePermissions(database.DB, def.Permissions)
+			if err != nil {
+				return err
+			}
+			if err := database.DB.Model(&role).Association("Permissions").Replace(perms); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Existing installs treated user 1 as the only admin; keep that working
+	// until an admin is assigned explicitly.
+	var admins int64
+	database.DB.Table("user_roles").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ?", RoleAdmin).
+		Count(&admins)
+	if admins == 0 {
+		var first models.User
+		if err := database.DB.Order("id ASC").First(&first).Error; err == nil {
+			if err := assignRole(first.ID, RoleAdmin); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Accounts created before roles existed have none; give them the member
+	// role so they keep the access every new account gets.
+	if err := database.DB.Exec(`
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT users.id, roles.id FROM users, roles
+		WHERE roles.name = ? AND users.deleted_at IS NULL
+		  AND NOT EXISTS (SELECT 1 FROM user_roles WHERE user_roles.user_id = users.id)`,
+		RoleMember).Error; err != nil {
+		return err
+	}
+
+	return loadRolePermissions()
+}
+
+// reloadRoles refreshes the role cache after an edit and tells the other
+// nodes to do the same.
+func reloadRoles() error {
+	if err := loadRolePermissions(); err != nil {
+		return err
+	}
+	Events.Publish(TopicRolesChanged, nil)
+	return nil
+}
+
+// onRolesChanged reloads the role cache after an edit made on another node.
+func onRolesChanged(payload []byte) {
+	if err := loadRolePermissions(); err != nil {
+		log.Printf("Failed to reload roles: %v", err)
+	}
+}
+
+func loadRolePermissions() error {
+	var roles []models.Role
+	if err := database.DB.Preload("Permissions").Find(&roles).Error; err != nil {
+		return err
+	}
+
+	mapping := make(map[string][]string, len(roles))
+	var twoFactor []string
+	for _, role := range roles {
+		if role.Require2FA {
+			twoFactor = append(twoFactor, role.Name)
+		}
+		perms := make([]string, 0, len(role.Permissions))
+		for _, perm := range role.Permissions {
+			perms = append(perms, perm.Name)
+		}
+		mapping[role.Name] = perms
+	}
+
+	middleware.SetRolePermissions(mapping)
+	middleware.SetTwoFactorRoles(twoFactor)
+	return nil
+}
+
+func findOrCreatePermissions(tx *gorm.DB, names []string) ([]models.Permission, error) {
+	perms := make([]models.Permission, 0, len(names))
+	for _, name := range names {
+		perm := models.Permission{Name: name}
+		if err := tx.Where("name = ?", name).FirstOrCreate(&perm).Error; err != nil {
+			return nil, err
+		}
+		perms = append(perms, perm)
+	}
+	return perms, nil
+}
+
+// isValidPermission reports whether name may be granted to a role. The
+// wildcard is reserved for the built-in admin role, which SeedRoles sets up.
+func isValidPermission(name string) bool {
+	return slices.Contains(middleware.KnownPermissions, name)
+}
+
+func userRoleNames(userID uint) ([]string, error) {
+	var names []string
+	err := database.DB.Table("roles").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.name ASC").
+		Pluck("roles.name", &names).Error
+	return names, err
+}
+
+func assignRole(userID uint, roleName string) error {
+	var role models.Role
+	if err := database.DB.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return err
+	}
+	return database.DB.Model(&models.User{ID: userID}).Association("Roles").Append(&role)
+}
+
+func GetRoles(c *gin.Context) {
+	var roles []models.Role
+	if err := database.DB.Preload("Permissions").Order("id ASC").Find(&roles).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"roles":       roles,
+		"permissions": middleware.KnownPermissions,
+	})
+}
+
+func CreateRole(c *gin.Context) {
+	var req struct {
+		Name        string   `json:"name" binding:"required,min=2,max=50"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+		Require2FA  bool     `json:"require_2fa"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	req.Name = strings.ToLower(req.Name)
+	for _, perm := range req.Permissions {
+		if !isValidPermission(perm) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + perm})
+			return
+		}
+	}
+
+	role := models.Role{
+		Name:        req.Name,
+		Description: req.Description,
+		Require2FA:  req.Require2FA,
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		perms, err := findOrCreatePermissions(tx, req.Permissions)
+		if err != nil {
+			return err
+		}
+		role.Permissions = perms
+		return tx.Create(&role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Role already exists"})
+		return
+	}
+
+	if err := reloadRoles(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload roles"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, role)
+}
+
+func UpdateRole(c *gin.Context) {
+	var role models.Role
+	if err := database.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	var req struct {
+		Description *string  `json:"description"`
+		Permissions []string `json:"permissions"`
+		// Require2FA makes every member of the role use 2FA; their sessions
+		// without it are limited to account routes until they enroll.
+		Require2FA *bool `json:"require_2fa"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if role.Name == RoleAdmin && req.Permissions != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admin permissions cannot be changed"})
+		return
+	}
+
+	for _, perm := range req.Permissions {
+		if !isValidPermission(perm) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission: " + perm})
+			return
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.Description != nil {
+			if err := tx.Model(&role).Update("description", *req.Description).Error; err != nil {
+				return err
+			}
+		}
+		if req.Require2FA != nil {
+			if err := tx.Model(&role).Update("require_2fa", *req.Require2FA).Error; err != nil {
+				return err
+			}
+		}
+		if req.Permissions != nil {
+			perms, err := findOrCreatePermissions(tx, req.Permissions)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&role).Association("Permissions").Replace(perms); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	if err := reloadRoles(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload roles"})
+		return
+	}
+
+	database.DB.Preload("Permissions").First(&role, role.ID)
+	c.JSON(http.StatusOK, role)
+}
+
+func DeleteRole(c *gin.Context) {
+	var role models.Role
+	if err := database.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	if role.BuiltIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be deleted"})
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM user_roles WHERE role_id = ?", role.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&role).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+
+	if err := reloadRoles(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted successfully"})
+}
+
+// SetUserRoles replaces the role set of a user. The change is picked up by
+// the user's next access token, i.e. within AccessTokenTTL.
+func SetUserRoles(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req struct {
+		Roles []string `json:"roles" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var roles []models.Role
+	if len(req.Roles) > 0 {
+		if err := database.DB.Where("name IN ?", req.Roles).Find(&roles).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+			return
+		}
+	}
+	if len(roles) != len(req.Roles) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role in request"})
+		return
+	}
+
+	current, err := userRoleNames(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	// roles.manage covers every role but admin, which only admins hand out.
+	if slices.Contains(current, RoleAdmin) != slices.Contains(req.Roles, RoleAdmin) && !middleware.Can(c, middleware.PermAll) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can grant or remove the admin role"})
+		return
+	}
+
+	if uint(userID) == c.GetUint("user_id") && !slices.Contains(req.Roles, RoleAdmin) && middleware.Can(c, middleware.PermAll) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot remove your own admin role"})
+		return
+	}
+
+	if err := database.DB.Model(&user).Association("Roles").Replace(roles); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User roles updated successfully",
+		"user_id": user.ID,
+		"roles":   roles,
+	})
+}
@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/models"
+)
+
+const (
+	SearchTypeThread  = "thread"
+	SearchTypePost    = "post"
+	SearchTypeMessage = "message"
+
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 50
+
+	// ts_headline marks matches with private-use characters so the snippet
+	// can be HTML-escaped before they are swapped for <mark> tags.
+	headlineStart         = "\uE000"
+	headlineStop          = "\uE001"
+	searchHeadlineOptions = `StartSel="` + headlineStart + `", StopSel="` + headlineStop + `", MaxWords=35, MinWords=15, MaxFragments=2`
+)
+
+// highlightReplacer turns the ts_headline markers into <mark> tags.
+var highlightReplacer = strings.NewReplacer(headlineStart, "<mark>", headlineStop, "</mark>")
+
+// SearchResult.Snippet is HTML: escaped user content with matches wrapped in
+// <mark>.
+type SearchResult struct {
+	Type       string    `json:"type"`
+	ID         uint      `json:"id"`
+	ThreadID   *uint     `json:"thread_id,omitempty"`
+	ChatroomID *uint     `json:"chatroom_id,omitempty"`
+	UserID     uint      `json:"user_id"`
+	Username   string    `json:"username"`
+	Title      string    `json:"title,omitempty"`
+	Snippet    string    `json:"snippet"`
+	Rank       float64   `json:"rank"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// searchFilters holds the optional filters shared by every search branch.
+type searchFilters struct {
+	authorID   uint
+	from       *time.Time
+	to         *time.Time
+	chatroomID uint
+}
+
+// where appends the filter clauses for a branch whose rows live in table.
+func (f searchFilters) where(table string, sql *strings.Builder, args *[]interface{}) {
+	if f.authorID != 0 {
+		sql.WriteString(" AND " + table + ".user_id = ?")
+		*args = append(*args, f.authorID)
+	}
+	if f.from != nil {
+		sql.WriteString(" AND " + table + ".created_at >= ?")
+		*args = append(*args, *f.from)
+	}
+	if f.to != nil {
+		sql.WriteString(" AND " + table + ".created_at < ?")
+		*args = append(*args, *f.to)
+	}
+}
+
+func parseSearchDate(value string, endOfDay bool) (*time.Time, error) {
+	if ts, err := time.Parse(time.RFC3339, value); err == nil {
+		return &ts, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1)
+	}
+	return &day, nil
+}
+
+// Search runs a ranked full-text query over thread titles, post bodies and
+// chat messages.
+func Search(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query required"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(DefaultSearchLimit)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+		return
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+		return
+	}
+
+	var filters searchFilters
+
+	if author := c.Query("author"); author != "" {
+		var user models.User
+		if err := database.DB.Where("username = ?", author).First(&user).Error; err != nil {
+			c.JSON(http.StatusOK, gin.H{"results": []SearchResult{}, "has_more": false})
+			return
+		}
+		filters.authorID = user.ID
+	}
+
+	if from := c.Query("from"); from != "" {
+		if filters.from, err = parseSearchDate(from, false); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+			return
+		}
+	}
+
+	if to := c.Query("to"); to != "" {
+		if filters.to, err = parseSearchDate(to, true); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+			return
+		}
+	}
+
+	types := map[string]bool{}
+	if raw := c.Query("type"); raw != "" {
+		for _, t := range strings.Split(raw, ",") {
+			t = strings.TrimSpace(t)
+			if t != SearchTypeThread && t != SearchTypePost && t != SearchTypeMessage {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type (thread, post, message)"})
+				return
+			}
+			types[t] = true
+		}
+	}
+
+	if raw := c.Query("chatroom_id"); raw != "" {
+		roomID, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chatroom ID"})
+			return
+		}
+		// A chatroom filter only makes sense for chat messages.
+		if types[SearchTypeThread] || types[SearchTypePost] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "chatroom_id can only be used with type=message"})
+			return
+		}
+		filters.chatroomID = uint(roomID)
+		types = map[string]bool{SearchTypeMessage: true}
+	}
+
+	if len(types) == 0 {
+		types = map[string]bool{SearchTypeThread: true, SearchTypePost: true, SearchTypeMessage: true}
+	}
+
+	var sql strings.Builder
+	var args []interface{}
+	branches := 0
+
+	union := func() {
+		if branches > 0 {
+			sql.WriteString(" UNION ALL ")
+		}
+		branches++
+	}
+
+	if types[SearchTypeThread] {
+		union()
+		sql.WriteString(`SELECT 'thread' AS type, threads.id, threads.id AS thread_id, NULL::bigint AS chatroom_id,
+			threads.user_id, users.username, threads.title,
+			ts_headline('english', threads.title, query, ?) AS snippet,
+			ts_rank(threads.search_vector, query) AS rank, threads.created_at
+			FROM threads JOIN users ON users.id = threads.user_id,
+			websearch_to_tsquery('english', ?) query
+			WHERE threads.search_vector @@ query AND threads.deleted_at IS NULL`)
+		args = append(args, searchHeadlineOptions, q)
+		filters.where("threads", &sql, &args)
+	}
+
+	if types[SearchTypePost] {
+		union()
+		sql.WriteString(`SELECT 'post' AS type, posts.id, posts.thread_id, NULL::bigint AS chatroom_id,
+			posts.user_id, users.username, threads.title,
+			ts_headline('english', posts.content, query, ?) AS snippet,
+			ts_rank(posts.search_vector, query) AS rank, posts.created_at
+			FROM posts JOIN users ON users.id = posts.user_id
+			JOIN threads ON threads.id = posts.thread_id,
+			websearch_to_tsquery('english', ?) query
+			WHERE posts.search_vector @@ query AND posts.deleted_at IS NULL AND threads.deleted_at IS NULL`)
+		args = append(args, searchHeadlineOptions, q)
+		filters.where("posts", &sql, &args)
+	}
+
+	if types[SearchTypeMessage] {
+		union()
+		sql.WriteString(`SELECT 'message' AS type, chat_messages.id, NULL::bigint AS thread_id, chat_messages.chatroom_id,
+			chat_messages.user_id, users.username, chatrooms.name AS title,
+			ts_headline('english', chat_messages.content, query, ?) AS snippet,
+			ts_rank(chat_messages.search_vector, query) AS rank, chat_messages.created_at
+			FROM chat_messages JOIN users ON users.id = chat_messages.user_id
+			JOIN chatrooms ON chatrooms.id = chat_messages.chatroom_id,
+			websearch_to_tsquery('english', ?) query
+			WHERE chat_messages.search_vector @@ query AND chat_messages.deleted_at IS NULL`)
+		args = append(args, searchHeadlineOptions, q)
+		filters.where("chat_messages", &sql, &args)
+		sql.WriteString(` AND (chatrooms.visibility = ? OR EXISTS (
+			SELECT 1 FROM chatroom_members
+			WHERE chatroom_members.chatroom_id = chatrooms.id AND chatroom_members.user_id = ?))`)
+		args = append(args, models.ChatroomPublic, c.GetUint("user_id"))
+		if filters.chatroomID != 0 {
+			sql.WriteString(" AND chat_messages.chatroom_id = ?")
+			args = append(args, filters.chatroomID)
+		}
+	}
+
+	sql.WriteString(" ORDER BY rank DESC, created_at DESC LIMIT ? OFFSET ?")
+	args = append(args, limit+1, offset)
+
+	results := []SearchResult{}
+	if err := database.DB.Raw(sql.String(), args...).Scan(&results).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Search failed"})
+		return
+	}
+
+	hasMore := len(results) > limit
+	if hasMore {
+		results = results[:limit]
+	}
+
+	for i := range results {
+		results[i].Snippet = highlightReplacer.Replace(html.EscapeString(results[i].Snippet))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":  results,
+		"has_more": hasMore,
+	})
+}
@@ -0,0 +1,298 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/middleware"
+	"github.com/rj-2006/techtalk/internal/models"
+	"gorm.io/gorm"
+)
+
+// errRefreshTokenRotated means another refresh rotated the token first.
+var errRefreshTokenRotated = errors.New("refresh token already rotated")
+
+type sessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// startSession creates a new device session for user and returns the first
+// access/refresh token pair for it. twoFactor records that the login passed a
+// second factor.
+func startSession(c *gin.Context, user models.User, twoFactor bool) (*sessionTokens, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:               uuid.New().String(),
+		UserID:           user.ID,
+		RefreshTokenHash: hashToken(refreshToken),
+		TwoFactor:        twoFactor,
+		UserAgent:        c.Request.UserAgent(),
+		IPAddress:        c.ClientIP(),
+		ExpiresAt:        now.Add(RefreshTokenTTL),
+		LastUsedAt:       now,
+	}
+
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+
+	accessToken, err := issueToken(user, session.ID, session.TwoFactor)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sessionTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+// revokedToken is the TopicSessionRevoked payload.
+type revokedToken struct {
+	JTI   string    `json:"jti"`
+	Until time.Time `json:"until"`
+}
+
+func revokeSession(session *models.Session) error {
+	now := time.Now()
+	if err := database.DB.Model(session).Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	middleware.RevokeToken(session.ID, now.Add(AccessTokenTTL))
+	Events.Publish(TopicSessionRevoked, revokedToken{JTI: session.ID, Until: now.Add(AccessTokenTTL)})
+	return nil
+}
+
+// onSessionRevoked applies a revocation made on another node.
+func onSessionRevoked(payload []byte) {
+	if payload == nil {
+		if err := LoadRevokedSessions(); err != nil {
+			log.Printf("Failed to reload revoked sessions: %v", err)
+		}
+		return
+	}
+
+	var revoked revokedToken
+	if err := json.Unmarshal(payload, &revoked); err != nil {
+		log.Printf("Invalid session revocation event: %v", err)
+		return
+	}
+	middleware.RevokeToken(revoked.JTI, revoked.Until)
+}
+
+// revokeUserSessions signs a user out everywhere.
+func revokeUserSessions(userID uint) error {
+	var sessions []models.Session
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL", userID).Find(&sessions).Error; err != nil {
+		return err
+	}
+	for i := range sessions {
+		if err := revokeSession(&sessions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadRevokedSessions seeds the in-memory revocation list with sessions whose
+// access tokens may still be in circulation, so a restart does not revive them.
+func LoadRevokedSessions() error {
+	var sessions []models.Session
+	if err := database.DB.Where("revoked_at > ?", time.Now().Add(-AccessTokenTTL)).
+		Find(&sessions).Error; err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		middleware.RevokeToken(session.ID, session.RevokedAt.Add(AccessTokenTTL))
+	}
+	return nil
+}
+
+func RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	presented := hashToken(req.RefreshToken)
+
+	var session models.Session
+	err := database.DB.Where("refresh_token_hash = ? AND revoked_at IS NULL", presented).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Any rotated-out token being replayed means it leaked; kill the session.
+		var retired models.RetiredRefreshToken
+		if database.DB.Where("token_hash = ?", presented).First(&retired).Error == nil &&
+			database.DB.Where("id = ? AND revoked_at IS NULL", retired.SessionID).First(&session).Error == nil {
+			if err := revokeSession(&session); err != nil {
+				log.Printf("Failed to revoke session %s after refresh token reuse: %v", session.ID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+				return
+			}
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token expired"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, session.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	// Conditional update so two concurrent refreshes with the same token
+	// cannot both succeed.
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Session{}).
+			Where("id = ? AND refresh_token_hash = ?", session.ID, presented).
+			Updates(map[string]interface{}{
+				"refresh_token_hash": hashToken(refreshToken),
+				"last_used_at":       time.Now(),
+				"ip_address":         c.ClientIP(),
+				"user_agent":         c.Request.UserAgent(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenRotated
+		}
+		return tx.Create(&models.RetiredRefreshToken{SessionID: session.ID, TokenHash: presented}).Error
+	})
+	if errors.Is(err, errRefreshTokenRotated) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	accessToken, err := issueToken(user, session.ID, session.TwoFactor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token."})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(AccessTokenTTL.Seconds()),
+	})
+}
+
+func Logout(c *gin.Context) {
+	sessionID := c.GetString("session_id")
+	if sessionID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is not bound to a session"})
+		return
+	}
+
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ?", sessionID, c.GetUint("user_id")).
+		First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := revokeSession(&session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+func GetSessions(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	currentID := c.GetString("session_id")
+
+	var sessions []models.Session
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	type SessionWithCurrent struct {
+		models.Session
+		Current bool `json:"current"`
+	}
+
+	result := make([]SessionWithCurrent, len(sessions))
+	for i, session := range sessions {
+		result[i] = SessionWithCurrent{
+			Session: session,
+			Current: session.ID == currentID,
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func RevokeSession(c *gin.Context) {
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), c.GetUint("user_id")).
+		First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := revokeSession(&session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
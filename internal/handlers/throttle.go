@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/models"
+	"github.com/rj-2006/techtalk/internal/ratelimit"
+)
+
+var (
+	// An address gets more room than an account, since many users can
+	// share one behind NAT.
+	LoginIPPolicy = ratelimit.Policy{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockoutAfter: 100,
+		LockoutFor:   time.Hour,
+		Window:       time.Hour,
+	}
+	LoginAccountPolicy = ratelimit.Policy{
+		FreeAttempts: 5,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockoutAfter: 10,
+		LockoutFor:   15 * time.Minute,
+		Window:       time.Hour,
+	}
+	RegisterPolicy = ratelimit.Policy{
+		FreeAttempts: 5,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}
+	// Mail policies cap reset and verification emails, so the endpoints
+	// can't be used to flood someone's inbox.
+	MailIPPolicy = ratelimit.Policy{
+		FreeAttempts: 10,
+		BaseDelay:    time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}
+	MailAccountPolicy = ratelimit.Policy{
+		FreeAttempts: 3,
+		BaseDelay:    5 * time.Minute,
+		MaxDelay:     time.Hour,
+		Window:       time.Hour,
+	}
+)
+
+var (
+	LoginIPLimiter      *ratelimit.Limiter
+	LoginAccountLimiter *ratelimit.Limiter
+	RegisterLimiter     *ratelimit.Limiter
+	MailIPLimiter       *ratelimit.Limiter
+	MailAccountLimiter  *ratelimit.Limiter
+)
+
+func init() {
+	UseRateLimitStore(ratelimit.NewMemoryStore())
+}
+
+// UseRateLimitStore points every limiter at store. The default is in memory;
+// a ratelimit.DBStore makes limits hold across replicas.
+func UseRateLimitStore(store ratelimit.Store) {
+	LoginIPLimiter = ratelimit.NewLimiter(store, "login:ip:", LoginIPPolicy)
+	LoginAccountLimiter = ratelimit.NewLimiter(store, "login:account:", LoginAccountPolicy)
+	RegisterLimiter = ratelimit.NewLimiter(store, "register:ip:", RegisterPolicy)
+	MailIPLimiter = ratelimit.NewLimiter(store, "mail:ip:", MailIPPolicy)
+	MailAccountLimiter = ratelimit.NewLimiter(store, "mail:account:", MailAccountPolicy)
+}
+
+func accountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// retryAfter is the longest any of the keys is blocked for. A store error
+// lets the request through rather than locking everyone out.
+func retryAfter(limiter *ratelimit.Limiter, key string, wait time.Duration) time.Duration {
+	blocked, err := limiter.RetryAfter(key)
+	if err != nil {
+		log.Printf("Rate limit check failed for %s%s: %v", limiter.Prefix, key, err)
+		return wait
+	}
+	return max(wait, blocked)
+}
+
+func respondTooManyAttempts(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many attempts, try again later",
+		"retry_after": seconds,
+	})
+}
+
+// loginBlocked writes a 429 and audits the refusal if the caller's address or
+// the account is blocked.
+func loginBlocked(c *gin.Context, email string) bool {
+	wait := retryAfter(LoginIPLimiter, c.ClientIP(), 0)
+	wait = retryAfter(LoginAccountLimiter, accountKey(email), wait)
+	if wait <= 0 {
+		return false
+	}
+
+	auditLoginFailure(c, email, nil, models.LoginFailThrottled)
+	respondTooManyAttempts(c, wait)
+	return true
+}
+
+// mailBlocked writes a 429 if the caller's address or the recipient has asked
+// for too many emails; otherwise it counts this request against both.
+func mailBlocked(c *gin.Context, email string) bool {
+	wait := retryAfter(MailIPLimiter, c.ClientIP(), 0)
+	wait = retryAfter(MailAccountLimiter, accountKey(email), wait)
+	if wait > 0 {
+		respondTooManyAttempts(c, wait)
+		return true
+	}
+
+	if _, err := MailIPLimiter.Fail(c.ClientIP()); err != nil {
+		log.Printf("Failed to record mail request: %v", err)
+	}
+	if _, err := MailAccountLimiter.Fail(accountKey(email)); err != nil {
+		log.Printf("Failed to record mail request: %v", err)
+	}
+	return false
+}
+
+func auditLoginFailure(c *gin.Context, email string, userID *uint, reason string) {
+	attempt := models.LoginAttempt{
+		Email:     accountKey(email),
+		UserID:    userID,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Reason:    reason,
+	}
+	if err := database.DB.Create(&attempt).Error; err != nil {
+		log.Printf("Failed to audit login attempt: %v", err)
+	}
+}
+
+// recordLoginFailure audits a failed login and counts it against both the
+// caller's address and the account.
+func recordLoginFailure(c *gin.Context, email string, userID *uint, reason string) {
+	auditLoginFailure(c, email, userID, reason)
+
+	if _, err := LoginIPLimiter.Fail(c.ClientIP()); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+	if _, err := LoginAccountLimiter.Fail(accountKey(email)); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+}
+
+func recordLoginSuccess(email string) {
+	if err := LoginAccountLimiter.Reset(accountKey(email)); err != nil {
+		log.Printf("Failed to reset login limit: %v", err)
+	}
+}
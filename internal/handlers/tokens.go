@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rj-2006/techtalk/internal/database"
+	"github.com/rj-2006/techtalk/internal/middleware"
+	"github.com/rj-2006/techtalk/internal/models"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	MaxTokenLifetimeDays = 365
+
+	// last_used_at is only written this often per token.
+	tokenUsageResolution = time.Minute
+)
+
+// LookupPersonalToken resolves a personal access token for AuthMiddleware. It
+// is installed as middleware.LookupPersonalToken.
+func LookupPersonalToken(token string) (*middleware.TokenIdentity, error) {
+	var record models.PersonalAccessToken
+	err := database.DB.Preload("User").
+		Where("token_hash = ? AND revoked_at IS NULL", hashToken(token)).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if record.ExpiresAt != nil && now.After(*record.ExpiresAt) {
+		return nil, nil
+	}
+	// A deleted user's token is not loaded with it.
+	if record.User.ID == 0 {
+		return nil, nil
+	}
+
+	roles, err := userRoleNames(record.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !record.User.IsBot {
+		roles = middleware.UnprivilegedRoles(roles)
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > tokenUsageResolution {
+		database.DB.Model(&record).Update("last_used_at", now)
+	}
+
+	return &middleware.TokenIdentity{
+		TokenID:       record.ID,
+		UserID:        record.UserID,
+		Username:      record.User.Username,
+		Roles:         roles,
+		Scopes:        record.Scopes,
+		Bot:           record.User.IsBot,
+		EmailVerified: record.User.IsBot || record.User.EmailVerifiedAt != nil,
+		TwoFactor:     record.TwoFactor,
+	}, nil
+}
+
+// CreatePersonalToken issues a token for the caller, or for a bot they own.
+// The token itself is only returned here.
+func CreatePersonalToken(c *gin.Context) {
+	var req struct {
+		Name          string   `json:"name" binding:"required,min=1,max=100"`
+		Scopes        []string `json:"scopes" binding:"required,min=1"`
+		ExpiresInDays int      `json:"expires_in_days"` // 0 never expires
+		BotID         *uint    `json:"bot_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		if !slices.Contains(middleware.KnownScopes, scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+			return
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > MaxTokenLifetimeDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must be between 0 and " + strconv.Itoa(MaxTokenLifetimeDays)})
+		return
+	}
+
+	callerID := c.GetUint("user_id")
+	ownerID := callerID
+	if req.BotID != nil {
+		bot, ok := loadOwnedBot(c, *req.BotID)
+		if !ok {
+			return
+		}
+		ownerID = bot.ID
+	}
+
+	secret, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	token := middleware.PersonalTokenPrefix + secret
+
+	record := models.PersonalAccessToken{
+		UserID:    ownerID,
+		CreatedBy: callerID,
+		Name:      req.Name,
+		Prefix:    token[:len(middleware.PersonalTokenPrefix)+6],
+		TokenHash: hashToken(token),
+		Scopes:    scopes,
+		TwoFactor: c.GetBool("two_factor"),
+	}
+	if req.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		record.ExpiresAt = &expires
+	}
+
+	if err := database.DB.Create(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	database.DB.Preload("User").First(&record, record.ID)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":                 token,
+		"personal_access_token": record,
+	})
+}
+
+// GetPersonalTokens lists the live tokens the caller created, for themselves
+// and their bots.
+func GetPersonalTokens(c *gin.Context) {
+	var tokens []models.PersonalAccessToken
+	if err := database.DB.Preload("User").
+		Where("created_by = ? AND revoked_at IS NULL", c.GetUint("user_id")).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func RevokePersonalToken(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var token models.PersonalAccessToken
+	if err := database.DB.Where("id = ? AND (created_by = ? OR user_id = ?) AND revoked_at IS NULL", c.Param("id"), userID, userID).
+		First(&token).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	if err := database.DB.Model(&token).Update("revoked_at", time.Now()).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully"})
+}
+
+// revokeUserTokens revokes every personal access token that acts as the user
+// or that they issued for one of their bots.
+func revokeUserTokens(tx *gorm.DB, userID uint) error {
+	return tx.Model(&models.PersonalAccessToken{}).
+		Where("(user_id = ? OR created_by = ?) AND revoked_at IS NULL", userID, userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// loadOwnedBot fetches a bot the caller owns, or any bot for a bot manager.
+func loadOwnedBot(c *gin.Context, botID uint) (*models.User, bool) {
+	var bot models.User
+	if err := database.DB.Where("id = ? AND is_bot = ?", botID, true).First(&bot).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bot not found"})
+		return nil, false
+	}
+
+	owned := bot.BotOwnerID != nil && *bot.BotOwnerID == c.GetUint("user_id")
+	if !owned && !middleware.Can(c, middleware.PermBotsManage) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bot not found"})
+		return nil, false
+	}
+	return &bot, true
+}
+
+// CreateBot creates a bot account owned by the caller. Bots have no usable
+// password; give them a personal access token to act.
+func CreateBot(c *gin.Context) {
+	var req struct {
+		Username string `json:"username" binding:"required,min=3,max=50"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	password, err := randomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bot"})
+		return
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create bot"})
+		return
+	}
+
+	ownerID := c.GetUint("user_id")
+	bot := models.User{
+		Username: req.Username,
+		// Bots need a unique address but must never be mailed; .invalid
+		// is reserved for that.
+		Email:      "bot-" + req.Username + "@bots.invalid",
+		Password:   string(hashedPassword),
+		IsBot:      true,
+		BotOwnerID: &ownerID,
+	}
+
+	if err := database.DB.Create(&bot).Error; err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+		return
+	}
+	if err := assignRole(bot.ID, RoleMember); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign default role"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, bot)
+}
+
+// GetBots lists the caller's bots.
+func GetBots(c *gin.Context) {
+	var bots []models.User
+	if err := database.DB.Where("is_bot = ? AND bot_owner_id = ?", true, c.GetUint("user_id")).
+		Order("created_at DESC").
+		Find(&bots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch bots"})
+		return
+	}
+	c.JSON(http.StatusOK, bots)
+}
@@ -12,8 +12,14 @@ import (
 )
 
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
+	UserID   uint     `json:"user_id"`
+	Username string   `json:"username"`
+	Roles    []string `json:"roles,omitempty"`
+	// TwoFactor is set when the session was started with a second factor.
+	TwoFactor bool `json:"2fa,omitempty"`
+	// EmailVerified reflects the account when the token was issued; a user
+	// who verifies later picks it up on their next refresh.
+	EmailVerified bool `json:"ev,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -45,6 +51,11 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(token, PersonalTokenPrefix) {
+			authenticatePersonalToken(c, token)
+			return
+		}
+
 		secret, err := JWTSecret()
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Authentication is not configured"})
@@ -63,8 +74,18 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		claims := parsedToken.Claims.(*Claims)
+		if claims.ID != "" && IsTokenRevoked(claims.ID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("session_id", claims.ID)
+		c.Set("roles", claims.Roles)
+		c.Set("two_factor", claims.TwoFactor)
+		c.Set("email_verified", claims.EmailVerified)
 		c.Next()
 	}
 }
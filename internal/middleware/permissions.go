@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PermAll           = "*"
+	PermEmojiManage   = "emoji.manage"
+	PermRolesManage   = "roles.manage"
+	PermForumModerate = "forum.moderate"
+	PermChatModerate  = "chat.moderate"
+	PermBotsManage    = "bots.manage"
+)
+
+var KnownPermissions = []string{
+	PermEmojiManage,
+	PermRolesManage,
+	PermForumModerate,
+	PermChatModerate,
+	PermBotsManage,
+}
+
+// rolePermissions caches the permission set of every role so checks against
+// the roles embedded in a token never hit the database.
+var rolePermissions = struct {
+	sync.RWMutex
+	roles map[string]map[string]bool
+}{roles: make(map[string]map[string]bool)}
+
+// SetRolePermissions replaces the cached role -> permissions mapping.
+func SetRolePermissions(roles map[string][]string) {
+	next := make(map[string]map[string]bool, len(roles))
+	for role, perms := range roles {
+		set := make(map[string]bool, len(perms))
+		for _, perm := range perms {
+			set[perm] = true
+		}
+		next[role] = set
+	}
+
+	rolePermissions.Lock()
+	rolePermissions.roles = next
+	rolePermissions.Unlock()
+}
+
+func HasPermission(roles []string, perm string) bool {
+	rolePermissions.RLock()
+	defer rolePermissions.RUnlock()
+
+	for _, role := range roles {
+		perms := rolePermissions.roles[role]
+		if perms[PermAll] || perms[perm] {
+			return true
+		}
+	}
+	return false
+}
+
+// UnprivilegedRoles returns the roles in names that grant no permissions.
+func UnprivilegedRoles(names []string) []string {
+	rolePermissions.RLock()
+	defer rolePermissions.RUnlock()
+
+	unprivileged := make([]string, 0, len(names))
+	for _, role := range names {
+		if len(rolePermissions.roles[role]) == 0 {
+			unprivileged = append(unprivileged, role)
+		}
+	}
+	return unprivileged
+}
+
+// Can reports whether the authenticated caller holds perm.
+func Can(c *gin.Context, perm string) bool {
+	roles, _ := c.Get("roles")
+	names, _ := roles.([]string)
+	return HasPermission(names, perm)
+}
+
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !Can(c, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
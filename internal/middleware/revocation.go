@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+)
+
+// revokedTokens holds the jti of every session revoked while its access
+// tokens could still be valid, so AuthMiddleware can reject them without
+// touching the database.
+var revokedTokens = struct {
+	sync.RWMutex
+	entries map[string]time.Time
+}{entries: make(map[string]time.Time)}
+
+// RevokeToken rejects access tokens carrying jti until the given time.
+func RevokeToken(jti string, until time.Time) {
+	if jti == "" {
+		return
+	}
+
+	revokedTokens.Lock()
+	defer revokedTokens.Unlock()
+
+	now := time.Now()
+	for id, expiry := range revokedTokens.entries {
+		if now.After(expiry) {
+			delete(revokedTokens.entries, id)
+		}
+	}
+
+	if current, ok := revokedTokens.entries[jti]; !ok || until.After(current) {
+		revokedTokens.entries[jti] = until
+	}
+}
+
+func IsTokenRevoked(jti string) bool {
+	revokedTokens.RLock()
+	defer revokedTokens.RUnlock()
+
+	until, ok := revokedTokens.entries[jti]
+	return ok && time.Now().Before(until)
+}
@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PersonalTokenPrefix marks a personal access token, so AuthMiddleware can
+// tell one from a JWT without parsing it.
+const PersonalTokenPrefix = "ttp_"
+
+const (
+	ScopeRead       = "read"
+	ScopeForumWrite = "forum:write"
+	ScopeChatWrite  = "chat:write"
+)
+
+var KnownScopes = []string{ScopeRead, ScopeForumWrite, ScopeChatWrite}
+
+// TokenIdentity is who a personal access token acts as, and what it may do.
+type TokenIdentity struct {
+	TokenID  uint
+	UserID   uint
+	Username string
+	// Roles are the roles the token acts with: a bot's own roles, but only
+	// the permissionless roles of a user, so a user's token never moderates.
+	Roles  []string
+	Scopes []string
+	Bot    bool
+	// EmailVerified is always true for bots, which have no mailbox.
+	EmailVerified bool
+	// TwoFactor is whether the token was created from a session that passed
+	// 2FA.
+	TwoFactor bool
+}
+
+// LookupPersonalToken resolves a presented personal access token, returning
+// nil if it is unknown, revoked or expired. It is installed from main.
+var LookupPersonalToken func(token string) (*TokenIdentity, error)
+
+// Routes personal access tokens can never use, whatever their scopes, so a
+// leaked token can't mint more tokens or take over the account.
+var tokenDeniedPrefixes = []string{
+	"/api/tokens",
+	"/api/bots",
+	"/api/sessions",
+	"/api/logout",
+	"/api/2fa",
+	"/api/email",
+	"/api/roles",
+	"/api/users/:id/roles",
+}
+
+var (
+	forumWritePrefixes = []string{"/api/threads", "/api/upload/image"}
+	chatWritePrefixes  = []string{"/api/chatrooms", "/api/invites", "/api/dms"}
+)
+
+func hasAnyPrefix(path string, prefixes []string) bool {
+	return slices.ContainsFunc(prefixes, func(prefix string) bool {
+		return strings.HasPrefix(path, prefix)
+	})
+}
+
+// requiredScope returns the scope a personal access token needs for a route,
+// or "" if tokens can't use it. Reads need ScopeRead; writes need the write
+// scope of their area. A chat websocket can post, so it needs ScopeChatWrite.
+func requiredScope(method, path string) string {
+	switch {
+	case path == "" || hasAnyPrefix(path, tokenDeniedPrefixes):
+		return ""
+	case strings.HasPrefix(path, "/api/chatrooms/") && strings.HasSuffix(path, "/ws"):
+		return ScopeChatWrite
+	case method == http.MethodGet || method == http.MethodHead:
+		return ScopeRead
+	case hasAnyPrefix(path, forumWritePrefixes):
+		return ScopeForumWrite
+	case hasAnyPrefix(path, chatWritePrefixes):
+		return ScopeChatWrite
+	}
+	return ""
+}
+
+// authenticatePersonalToken is AuthMiddleware for a personal access token.
+func authenticatePersonalToken(c *gin.Context, token string) {
+	if LookupPersonalToken == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Token"})
+		c.Abort()
+		return
+	}
+
+	identity, err := LookupPersonalToken(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check token"})
+		c.Abort()
+		return
+	}
+	if identity == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Token"})
+		c.Abort()
+		return
+	}
+
+	scope := requiredScope(c.Request.Method, c.FullPath())
+	if scope == "" || !slices.Contains(identity.Scopes, scope) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":          "Token does not have the required scope",
+			"required_scope": scope,
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", identity.UserID)
+	c.Set("username", identity.Username)
+	c.Set("roles", identity.Roles)
+	c.Set("token_id", identity.TokenID)
+	c.Set("token_scopes", identity.Scopes)
+	c.Set("bot", identity.Bot)
+	c.Set("email_verified", identity.EmailVerified)
+	c.Set("two_factor", identity.TwoFactor)
+	c.Next()
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// twoFactorRoles caches the roles whose members must use 2FA.
+var twoFactorRoles = struct {
+	sync.RWMutex
+	roles map[string]bool
+}{roles: make(map[string]bool)}
+
+// SetTwoFactorRoles replaces the cached set of roles that require 2FA.
+func SetTwoFactorRoles(roles []string) {
+	next := make(map[string]bool, len(roles))
+	for _, role := range roles {
+		next[role] = true
+	}
+
+	twoFactorRoles.Lock()
+	twoFactorRoles.roles = next
+	twoFactorRoles.Unlock()
+}
+
+// RequiresTwoFactor reports whether any of roles requires 2FA.
+func RequiresTwoFactor(roles []string) bool {
+	twoFactorRoles.RLock()
+	defer twoFactorRoles.RUnlock()
+
+	for _, role := range roles {
+		if twoFactorRoles.roles[role] {
+			return true
+		}
+	}
+	return false
+}
+
+// Require2FA rejects callers whose role requires 2FA but whose session was not
+// started with it. It must run after AuthMiddleware; routes a user needs to
+// enroll stay outside it.
+func Require2FA() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles, _ := c.Get("roles")
+		names, _ := roles.([]string)
+		if RequiresTwoFactor(names) && !c.GetBool("two_factor") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Two-factor authentication is required for your role",
+				"code":  "two_factor_required",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -7,14 +7,30 @@ import (
 )
 
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Username  string         `gorm:"unique;not null" json:"username"`
-	Email     string         `gorm:"unique;not null" json:"email"`
-	Password  string         `gorm:"not null" json:"-"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
-	Avatar    string         `gorm:"default:null" json:"avatar,omitempty"`
+	ID         uint           `gorm:"primaryKey" json:"id"`
+	Username   string         `gorm:"unique;not null" json:"username"`
+	Email      string         `gorm:"unique;not null" json:"email"`
+	Password   string         `gorm:"not null" json:"-"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"-"`
+	Avatar     string         `gorm:"default:null" json:"avatar,omitempty"`
+	Roles      []Role         `gorm:"many2many:user_roles" json:"roles,omitempty"`
+	LastSeenAt *time.Time     `json:"last_seen_at,omitempty"`
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+
+	// TOTPSecret is set during enrollment and only in effect once
+	// TOTPEnabledAt is. TOTPLastStep is the last time step a code was
+	// accepted for, so a code can't be used twice.
+	TOTPSecret    string     `json:"-"`
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at,omitempty"`
+	TOTPLastStep  int64      `gorm:"not null;default:0" json:"-"`
+
+	// Bots are accounts for automation. They act only through personal
+	// access tokens, which their owner manages.
+	IsBot      bool  `gorm:"not null;default:false" json:"is_bot"`
+	BotOwnerID *uint `gorm:"index" json:"bot_owner_id,omitempty"`
 }
 
 type Thread struct {
@@ -27,26 +43,78 @@ type Thread struct {
 	UpdatedAt time.Time        `json:"updated_at"`
 	Images    []ThreadImage    `gorm:"foreignKey:ThreadID" json:"images,omitempty"`
 	Reactions []ThreadReaction `gorm:"foreignKey:ThreadID" json:"reactions,omitempty"`
+	EditedAt  *time.Time       `json:"edited_at,omitempty"`
+	DeletedAt *time.Time       `gorm:"index" json:"deleted_at,omitempty"` // soft delete, title becomes "[deleted]"
 }
 
 type Post struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Content   string     `gorm:"type:text;not null" json:"content"`
+	ThreadID  uint       `gorm:"not null" json:"thread_id"`
+	UserID    uint       `gorm:"not null" json:"user_id"`
+	User      User       `gorm:"foreignKey:UserID" json:"user"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`              // soft delete, content becomes "[deleted]"
+	Bot       bool       `gorm:"not null;default:false" json:"bot"` // posted by a bot account
+}
+
+type PostRevision struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
+	PostID    uint      `gorm:"not null;index" json:"post_id"`
 	Content   string    `gorm:"type:text;not null" json:"content"`
-	ThreadID  uint      `gorm:"not null" json:"thread_id"`
-	UserID    uint      `gorm:"not null" json:"user_id"`
-	User      User      `gorm:"foreignKey:UserID" json:"user"`
+	EditedBy  uint      `gorm:"not null" json:"edited_by"`
+	Editor    User      `gorm:"foreignKey:EditedBy" json:"editor"`
 	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
 }
 
+const (
+	ChatroomPublic     = "public"      // listed, anyone can join
+	ChatroomInviteOnly = "invite_only" // listed, joining needs an invite
+	ChatroomPrivate    = "private"     // only visible to members
+
+	ChatroomKindRoom = "room"
+	ChatroomKindDM   = "dm" // direct message conversation, never listed as a room
+
+	ChatroomRoleOwner     = "owner"
+	ChatroomRoleModerator = "moderator"
+	ChatroomRoleMember    = "member"
+)
+
 type Chatroom struct {
 	ID          uint      `gorm:"primaryKey" json:"id"`
 	Name        string    `gorm:"not null" json:"name"`
 	Description string    `gorm:"type:text" json:"description"`
+	Visibility  string    `gorm:"not null;default:'public'" json:"visibility"`
+	Kind        string    `gorm:"not null;default:'room';index" json:"kind"`
+	DMKey       *string   `gorm:"uniqueIndex" json:"-"` // sorted participant IDs, set for DMs only
 	CreatedBy   uint      `gorm:"not null" json:"created_by"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+type ChatroomMember struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ChatroomID uint      `gorm:"not null;uniqueIndex:idx_chatroom_member" json:"chatroom_id"`
+	UserID     uint      `gorm:"not null;uniqueIndex:idx_chatroom_member;index" json:"user_id"`
+	User       User      `gorm:"foreignKey:UserID" json:"user"`
+	Role       string    `gorm:"not null;default:'member'" json:"role"`
+	LastReadID uint      `gorm:"not null;default:0" json:"last_read_message_id"`
+	CreatedAt  time.Time `json:"joined_at"`
+}
+
+type ChatroomInvite struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	ChatroomID uint       `gorm:"not null;index" json:"chatroom_id"`
+	Code       string     `gorm:"unique;not null" json:"code"`
+	CreatedBy  uint       `gorm:"not null" json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	MaxUses    int        `gorm:"not null;default:0" json:"max_uses"` // 0 means unlimited
+	Uses       int        `gorm:"not null;default:0" json:"uses"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
 type ChatMessage struct {
 	ID         uint              `gorm:"primaryKey" json:"id"`
 	ChatroomID uint              `gorm:"not null;index" json:"chatroom_id"`
@@ -55,25 +123,99 @@ type ChatMessage struct {
 	Content    string            `gorm:"type:text;not null" json:"content"`
 	CreatedAt  time.Time         `json:"created_at"`
 	Reactions  []MessageReaction `gorm:"foreignKey:MessageID" json:"reactions,omitempty"`
+	EditedAt   *time.Time        `json:"edited_at,omitempty"`
+	DeletedAt  *time.Time        `json:"deleted_at,omitempty"` // tombstone, content becomes "[deleted]"
+	// ClientMsgID is chosen by the sender so a retried send is saved once.
+	ClientMsgID *string `gorm:"size:64" json:"client_msg_id,omitempty"`
 }
 
+const (
+	GameStatusWaiting  = "waiting"
+	GameStatusPlaying  = "playing"
+	GameStatusFinished = "finished"
+)
+
 type GameRoom struct {
+	ID         uint             `gorm:"primaryKey" json:"id"`
+	Name       string           `gorm:"not null" json:"name"`
+	GameType   string           `gorm:"not null" json:"game_type"` // "smash_karts"
+	MaxPlayers int              `gorm:"default:8" json:"max_players"`
+	Status     string           `gorm:"default:'waiting';index" json:"status"` // waiting, playing, finished
+	CreatedBy  uint             `gorm:"not null" json:"created_by"`
+	CreatedAt  time.Time        `json:"created_at"`
+	StartedAt  *time.Time       `json:"started_at,omitempty"`
+	Players    []GameRoomPlayer `gorm:"foreignKey:GameRoomID" json:"players,omitempty"`
+}
+
+// GameRoomPlayer is a seat in a game room. Seats are numbered from 0 and
+// unique per room, as is each user.
+type GameRoomPlayer struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
-	Name       string    `gorm:"not null" json:"name"`
-	GameType   string    `gorm:"not null" json:"game_type"` // "smash_karts"
-	MaxPlayers int       `gorm:"default:8" json:"max_players"`
-	Status     string    `gorm:"default:'waiting'" json:"status"` // waiting, playing, finished
-	CreatedBy  uint      `gorm:"not null" json:"created_by"`
-	CreatedAt  time.Time `json:"created_at"`
+	GameRoomID uint      `gorm:"not null;uniqueIndex:idx_game_room_players_user;uniqueIndex:idx_game_room_players_seat" json:"game_room_id"`
+	UserID     uint      `gorm:"not null;uniqueIndex:idx_game_room_players_user" json:"user_id"`
+	User       User      `gorm:"foreignKey:UserID" json:"user"`
+	Seat       int       `gorm:"not null;uniqueIndex:idx_game_room_players_seat" json:"seat"`
+	Ready      bool      `gorm:"not null;default:false" json:"ready"`
+	CreatedAt  time.Time `json:"joined_at"`
 }
 
 type GameState struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
 	GameRoomID uint      `gorm:"not null;uniqueIndex" json:"game_room_id"`
 	StateData  string    `gorm:"type:jsonb" json:"state_data"` // JSON blob
+	Tick       uint64    `gorm:"not null;default:0" json:"tick"`
 	UpdatedAt  time.Time `json:"updated_at"`
 }
 
+// ReplayEntry is one row of a game room's append-only replay log: an accepted
+// input or a periodic state snapshot. Rows are played back in ID order.
+type ReplayEntry struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	GameRoomID uint      `gorm:"not null;index" json:"game_room_id"`
+	Tick       uint64    `gorm:"not null" json:"tick"`
+	Kind       string    `gorm:"size:1;not null" json:"kind"` // "i" input, "s" snapshot
+	PlayerID   uint      `json:"player_id,omitempty"`
+	Data       string    `gorm:"type:jsonb;not null" json:"data"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// MatchResult is written once, when a game room's match finishes.
+type MatchResult struct {
+	ID           uint               `gorm:"primaryKey" json:"id"`
+	GameRoomID   uint               `gorm:"not null;uniqueIndex" json:"game_room_id"`
+	GameRoom     GameRoom           `gorm:"foreignKey:GameRoomID" json:"-"`
+	GameType     string             `gorm:"not null;index" json:"game_type"`
+	FinishedAt   time.Time          `gorm:"not null" json:"finished_at"`
+	Participants []MatchParticipant `gorm:"foreignKey:MatchResultID" json:"participants,omitempty"`
+}
+
+// MatchParticipant is one player's placement in a match and how it moved
+// their rating.
+type MatchParticipant struct {
+	ID            uint    `gorm:"primaryKey" json:"id"`
+	MatchResultID uint    `gorm:"not null;uniqueIndex:idx_match_participants_user" json:"match_result_id"`
+	UserID        uint    `gorm:"not null;uniqueIndex:idx_match_participants_user;index" json:"user_id"`
+	User          User    `gorm:"foreignKey:UserID" json:"user"`
+	Placement     int     `gorm:"not null" json:"placement"` // 1 is first; ties share a placement
+	Score         int     `json:"score"`
+	RatingBefore  float64 `json:"rating_before"`
+	RatingAfter   float64 `json:"rating_after"`
+}
+
+// PlayerRating is a user's Elo rating for one game type.
+type PlayerRating struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_player_ratings_user_game" json:"user_id"`
+	User      User      `gorm:"foreignKey:UserID" json:"user"`
+	GameType  string    `gorm:"not null;uniqueIndex:idx_player_ratings_user_game;index:idx_player_ratings_leaderboard,priority:1" json:"game_type"`
+	Rating    float64   `gorm:"not null;default:1200;index:idx_player_ratings_leaderboard,priority:2,sort:desc" json:"rating"`
+	Games     int       `gorm:"not null;default:0" json:"games"`
+	Wins      int       `gorm:"not null;default:0" json:"wins"`
+	Losses    int       `gorm:"not null;default:0" json:"losses"`
+	Draws     int       `gorm:"not null;default:0" json:"draws"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 type ThreadImage struct {
 	ID       uint   `gorm:"primaryKey" json:"id"`
 	ThreadID uint   `gorm:"not null;index" json:"thread_id"`
@@ -106,3 +248,166 @@ type CustomEmoji struct {
 	CreatedBy uint      `gorm:"not null" json:"created_by"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+type Session struct {
+	ID               string     `gorm:"primaryKey;size:36" json:"id"`
+	UserID           uint       `gorm:"not null;index" json:"user_id"`
+	TwoFactor        bool       `gorm:"not null;default:false" json:"two_factor"`
+	RefreshTokenHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	UserAgent        string     `json:"user_agent"`
+	IPAddress        string     `json:"ip_address"`
+	ExpiresAt        time.Time  `gorm:"not null" json:"expires_at"`
+	LastUsedAt       time.Time  `json:"last_used_at"`
+	RevokedAt        *time.Time `gorm:"index" json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// RetiredRefreshToken records every refresh token a session has rotated out,
+// so a replay of any of them can be traced back to the session.
+type RetiredRefreshToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	SessionID string    `gorm:"not null;size:36;index" json:"session_id"`
+	TokenHash string    `gorm:"not null;uniqueIndex" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PersonalAccessToken lets scripts and bots call the API as UserID without a
+// password. Only the token's hash is stored; Prefix is kept so users can tell
+// their tokens apart.
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	User       User       `gorm:"foreignKey:UserID" json:"user"`
+	CreatedBy  uint       `gorm:"not null" json:"created_by"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null;size:16" json:"prefix"`
+	TokenHash  string     `gorm:"not null;uniqueIndex" json:"-"`
+	Scopes     []string   `gorm:"serializer:json" json:"scopes"`
+	TwoFactor  bool       `gorm:"not null;default:false" json:"two_factor"` // created from a session that passed 2FA
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// UserIdentity links a user to an account at an external OpenID Connect
+// provider.
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Issuer    string    `gorm:"not null;uniqueIndex:idx_user_identities_subject" json:"issuer"`
+	Subject   string    `gorm:"not null;uniqueIndex:idx_user_identities_subject" json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCLoginState holds an SSO login between the redirect to the provider and
+// its callback. The state parameter is stored hashed.
+type OIDCLoginState struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"not null;uniqueIndex"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"not null;index"`
+	CreatedAt    time.Time
+}
+
+// RecoveryCode is a one-time code that stands in for a TOTP code. Only its
+// hash is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// LoginChallenge is the second step of a login for a user with 2FA: the
+// password has been checked, and the challenge token is traded for a session
+// once a code is.
+type LoginChallenge struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"not null;uniqueIndex"`
+	Attempts  int       `gorm:"not null;default:0"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+const (
+	EmailTokenVerify = "verify_email"
+	EmailTokenReset  = "reset_password"
+)
+
+// EmailToken is a single-use token mailed to a user. Only its SHA-256 hash is
+// stored.
+type EmailToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	Purpose   string     `gorm:"not null;size:32" json:"purpose"`
+	TokenHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type Role struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"unique;not null" json:"name"`
+	Description string       `json:"description"`
+	BuiltIn     bool         `gorm:"default:false" json:"built_in"`
+	Require2FA  bool         `gorm:"column:require_2fa;default:false" json:"require_2fa"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+type Permission struct {
+	ID   uint   `gorm:"primaryKey" json:"id"`
+	Name string `gorm:"unique;not null" json:"name"`
+}
+
+// RateLimit is the failure count for one throttled key, such as an IP or an
+// account, when limits are shared between replicas.
+type RateLimit struct {
+	Key           string    `gorm:"primaryKey;size:255"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"index"`
+	BlockedUntil  time.Time
+	UpdatedAt     time.Time
+}
+
+const (
+	LoginFailBadPassword = "bad_password"
+	LoginFailBadCode     = "bad_2fa_code"
+	LoginFailThrottled   = "throttled"
+)
+
+// LoginAttempt is an audit record of a failed or refused login.
+type LoginAttempt struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Email     string    `gorm:"index" json:"email"`
+	UserID    *uint     `gorm:"index" json:"user_id,omitempty"`
+	IPAddress string    `gorm:"index" json:"ip_address"`
+	UserAgent string    `json:"user_agent"`
+	Reason    string    `gorm:"not null;size:32" json:"reason"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// HubPresence is a user connected to a chat room on one server instance,
+// kept fresh by the Postgres hub backend so presence spans replicas.
+type HubPresence struct {
+	NodeID    string    `gorm:"primaryKey;size:36"`
+	RoomID    string    `gorm:"primaryKey"`
+	UserID    uint      `gorm:"primaryKey;autoIncrement:false"`
+	Username  string    `gorm:"not null"`
+	Status    string    `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"index"`
+}
+
+// HubMessage holds broadcasts too large for a NOTIFY payload.
+type HubMessage struct {
+	ID        uint      `gorm:"primaryKey"`
+	Payload   []byte    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"index"`
+}
@@ -0,0 +1,185 @@
+// Package oidctest runs a mock OpenID Connect issuer for tests: discovery,
+// JWKS, and a token endpoint that enforces PKCE and signs ID tokens.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rj-2006/techtalk/internal/oidc"
+)
+
+const keyID = "oidctest"
+
+// Identity is the user the issuer signs in. Audience and Nonce, when set,
+// replace the values the token would normally carry, to test rejection.
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+
+	Audience string
+	Nonce    string
+}
+
+type grant struct {
+	identity  Identity
+	nonce     string
+	challenge string
+}
+
+// Server is a mock issuer. Its URL is the issuer identifier.
+type Server struct {
+	*httptest.Server
+
+	ClientID string
+	// Issuer, if set, is advertised in discovery and tokens instead of URL.
+	Issuer string
+
+	// JWKSRequests counts fetches of the key set.
+	JWKSRequests atomic.Int64
+
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+// NewServer starts an issuer that accepts clientID. Close it when done.
+func NewServer(clientID string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{ClientID: clientID, key: key, grants: make(map[string]grant)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/token", s.token)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *Server) issuer() string {
+	if s.Issuer != "" {
+		return s.Issuer
+	}
+	return s.URL
+}
+
+// Authorize stands in for the browser leg: it records a sign-in of identity
+// for an AuthURL's nonce and code_challenge and returns the code the
+// provider would redirect back with.
+func (s *Server) Authorize(identity Identity, nonce, challenge string) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	code := base64.RawURLEncoding.EncodeToString(buf)
+
+	s.mu.Lock()
+	s.grants[code] = grant{identity: identity, nonce: nonce, challenge: challenge}
+	s.mu.Unlock()
+	return code
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.issuer(),
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	s.JWKSRequests.Add(1)
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("client_id") != s.ClientID {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	// Codes are single use, whether or not the exchange succeeds.
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+		return
+	}
+	if oidc.PKCEChallenge(r.PostForm.Get("code_verifier")) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	audience, nonce := s.ClientID, g.nonce
+	if g.identity.Audience != "" {
+		audience = g.identity.Audience
+	}
+	if g.identity.Nonce != "" {
+		nonce = g.identity.Nonce
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, oidc.Claims{
+		Email:             g.identity.Email,
+		EmailVerified:     g.identity.EmailVerified,
+		PreferredUsername: g.identity.PreferredUsername,
+		Nonce:             nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer(),
+			Subject:   g.identity.Subject,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	})
+	token.Header["kid"] = keyID
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,191 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rj-2006/techtalk/internal/oidc"
+	"github.com/rj-2006/techtalk/internal/oidc/oidctest"
+)
+
+const clientID = "techtalk"
+
+func newProvider(issuer string) *oidc.Provider {
+	return oidc.NewProvider(oidc.Config{
+		Issuer:      issuer,
+		ClientID:    clientID,
+		RedirectURL: "http://app.test/api/auth/oidc/callback",
+	})
+}
+
+// authorize runs the provider's AuthURL through the mock issuer and returns
+// the code it grants.
+func authorize(t *testing.T, server *oidctest.Server, provider *oidc.Provider, identity oidctest.Identity, nonce, verifier string) string {
+	t.Helper()
+
+	authURL, err := provider.AuthURL(context.Background(), "state", nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("AuthURL is not a URL: %v", err)
+	}
+	query := parsed.Query()
+	return server.Authorize(identity, query.Get("nonce"), query.Get("code_challenge"))
+}
+
+func TestAuthURL(t *testing.T) {
+	server := oidctest.NewServer(clientID)
+	defer server.Close()
+
+	authURL, err := newProvider(server.URL).AuthURL(context.Background(), "the-state", "the-nonce", "the-verifier")
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	if !strings.HasPrefix(authURL, server.URL+"/authorize?") {
+		t.Fatalf("AuthURL = %s, want the discovered authorization endpoint", authURL)
+	}
+
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             clientID,
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        oidc.PKCEChallenge("the-verifier"),
+		"code_challenge_method": "S256",
+		"scope":                 "openid email profile",
+	}
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	server := oidctest.NewServer(clientID)
+	defer server.Close()
+	server.Issuer = "https://someone-else.test"
+
+	if _, err := newProvider(server.URL).AuthURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Fatal("AuthURL succeeded against a discovery document for another issuer")
+	}
+}
+
+// The verifier from RFC 7636 appendix B.
+func TestPKCEChallenge(t *testing.T) {
+	got := oidc.PKCEChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Errorf("PKCEChallenge = %s, want %s", got, want)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	identity := oidctest.Identity{
+		Subject:           "user-1",
+		Email:             "ada@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "ada",
+	}
+
+	tests := []struct {
+		name     string
+		identity oidctest.Identity
+		// exchangeVerifier and exchangeNonce default to the ones authorized.
+		exchangeVerifier string
+		exchangeNonce    string
+		wantErr          string
+	}{
+		{name: "valid", identity: identity},
+		{name: "wrong PKCE verifier", identity: identity, exchangeVerifier: "another-verifier", wantErr: "PKCE"},
+		{name: "nonce mismatch", identity: withNonce(identity, "replayed-nonce"), wantErr: "nonce"},
+		{name: "expected nonce differs", identity: identity, exchangeNonce: "other-login", wantErr: "nonce"},
+		{name: "audience mismatch", identity: withAudience(identity, "another-client"), wantErr: "aud"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := oidctest.NewServer(clientID)
+			defer server.Close()
+			provider := newProvider(server.URL)
+
+			const nonce, verifier = "login-nonce", "login-verifier"
+			code := authorize(t, server, provider, tt.identity, nonce, verifier)
+
+			exchangeVerifier, exchangeNonce := verifier, nonce
+			if tt.exchangeVerifier != "" {
+				exchangeVerifier = tt.exchangeVerifier
+			}
+			if tt.exchangeNonce != "" {
+				exchangeNonce = tt.exchangeNonce
+			}
+
+			claims, err := provider.Exchange(context.Background(), code, exchangeVerifier, exchangeNonce)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Exchange error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if claims.Subject != identity.Subject || claims.Email != identity.Email ||
+				!claims.EmailVerified || claims.PreferredUsername != identity.PreferredUsername {
+				t.Errorf("claims = %+v, want %+v", claims, identity)
+			}
+			if claims.Issuer != server.URL {
+				t.Errorf("issuer = %s, want %s", claims.Issuer, server.URL)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeIsSingleUse(t *testing.T) {
+	server := oidctest.NewServer(clientID)
+	defer server.Close()
+	provider := newProvider(server.URL)
+
+	identity := oidctest.Identity{Subject: "user-1", Email: "ada@example.com", EmailVerified: true}
+	code := authorize(t, server, provider, identity, "n", "v")
+
+	if _, err := provider.Exchange(context.Background(), code, "v", "n"); err != nil {
+		t.Fatalf("first Exchange: %v", err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, "v", "n"); err == nil {
+		t.Fatal("second Exchange with the same code succeeded")
+	}
+}
+
+func TestJWKSIsCached(t *testing.T) {
+	server := oidctest.NewServer(clientID)
+	defer server.Close()
+	provider := newProvider(server.URL)
+
+	identity := oidctest.Identity{Subject: "user-1", Email: "ada@example.com", EmailVerified: true}
+	for i := 0; i < 3; i++ {
+		code := authorize(t, server, provider, identity, "n", "v")
+		if _, err := provider.Exchange(context.Background(), code, "v", "n"); err != nil {
+			t.Fatalf("Exchange %d: %v", i+1, err)
+		}
+	}
+
+	if got := server.JWKSRequests.Load(); got != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", got)
+	}
+}
+
+func withNonce(identity oidctest.Identity, nonce string) oidctest.Identity {
+	identity.Nonce = nonce
+	return identity
+}
+
+func withAudience(identity oidctest.Identity, audience string) oidctest.Identity {
+	identity.Audience = audience
+	return identity
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/rj-2006/techtalk/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DBStore keeps entries in the rate_limits table, so limits hold across
+// replicas.
+type DBStore struct {
+	db      *gorm.DB
+	updates atomic.Uint64
+}
+
+func NewDBStore(db *gorm.DB) *DBStore {
+	return &DBStore{db: db}
+}
+
+func toEntry(row models.RateLimit) Entry {
+	return Entry{Failures: row.Failures, LastFailure: row.LastFailureAt, BlockedUntil: row.BlockedUntil}
+}
+
+func (s *DBStore) Get(key string) (Entry, error) {
+	var row models.RateLimit
+	err := s.db.Where("key = ?", key).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Entry{}, nil
+	}
+	if err != nil {
+		return Entry{}, err
+	}
+	return toEntry(row), nil
+}
+
+// Update inserts the row if it is missing, then locks it for the
+// read-modify-write.
+func (s *DBStore) Update(key string, fn func(entry *Entry)) (Entry, error) {
+	if s.updates.Add(1)%pruneEvery == 0 {
+		s.prune()
+	}
+
+	var entry Entry
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.RateLimit{Key: key}).Error; err != nil {
+			return err
+		}
+
+		var row models.RateLimit
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("key = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+
+		entry = toEntry(row)
+		fn(&entry)
+		return tx.Model(&row).Updates(map[string]interface{}{
+			"failures":        entry.Failures,
+			"last_failure_at": entry.LastFailure,
+			"blocked_until":   entry.BlockedUntil,
+		}).Error
+	})
+	return entry, err
+}
+
+func (s *DBStore) Reset(key string) error {
+	return s.db.Where("key = ?", key).Delete(&models.RateLimit{}).Error
+}
+
+func (s *DBStore) prune() {
+	now := time.Now()
+	s.db.Where("last_failure_at < ? AND blocked_until < ?", now.Add(-retention), now).
+		Delete(&models.RateLimit{})
+}
@@ -0,0 +1,112 @@
+// Package ratelimit throttles repeated failures, such as bad passwords, with
+// exponential backoff and a temporary lockout.
+package ratelimit
+
+import (
+	"time"
+)
+
+// Entry is the failure record for one key.
+type Entry struct {
+	Failures     int
+	LastFailure  time.Time
+	BlockedUntil time.Time
+}
+
+// Store keeps failure records. MemoryStore suits a single node; DBStore
+// shares them between replicas.
+type Store interface {
+	Get(key string) (Entry, error)
+
+	// Update applies fn to the key's entry atomically and saves the result.
+	Update(key string, fn func(entry *Entry)) (Entry, error)
+
+	Reset(key string) error
+}
+
+// Policy sets how a Limiter reacts to failures.
+type Policy struct {
+	// FreeAttempts is how many failures are allowed before any delay.
+	FreeAttempts int
+	// BaseDelay is the first delay, doubled on every further failure up to
+	// MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter failures block the key for LockoutFor.
+	LockoutAfter int
+	LockoutFor   time.Duration
+	// Failures are forgotten once none has happened for Window.
+	Window time.Duration
+}
+
+// Limiter applies a Policy to keys under Prefix in a Store, so several
+// limiters can share one.
+type Limiter struct {
+	Store  Store
+	Policy Policy
+	Prefix string
+}
+
+func NewLimiter(store Store, prefix string, policy Policy) *Limiter {
+	return &Limiter{Store: store, Policy: policy, Prefix: prefix}
+}
+
+// RetryAfter returns how long key is blocked for, or 0 if it may try now.
+func (l *Limiter) RetryAfter(key string) (time.Duration, error) {
+	entry, err := l.Store.Get(l.Prefix + key)
+	if err != nil {
+		return 0, err
+	}
+	if wait := time.Until(entry.BlockedUntil); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Fail records a failure for key and returns how long it is now blocked for.
+func (l *Limiter) Fail(key string) (time.Duration, error) {
+	now := time.Now()
+	entry, err := l.Store.Update(l.Prefix+key, func(entry *Entry) {
+		if now.Sub(entry.LastFailure) > l.Policy.Window {
+			entry.Failures = 0
+		}
+		entry.Failures++
+		entry.LastFailure = now
+
+		if blocked := now.Add(l.delay(entry.Failures)); blocked.After(entry.BlockedUntil) {
+			entry.BlockedUntil = blocked
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if wait := entry.BlockedUntil.Sub(now); wait > 0 {
+		return wait, nil
+	}
+	return 0, nil
+}
+
+// Reset forgets key's failures, e.g. after a successful login.
+func (l *Limiter) Reset(key string) error {
+	return l.Store.Reset(l.Prefix + key)
+}
+
+func (l *Limiter) delay(failures int) time.Duration {
+	p := l.Policy
+	if p.LockoutAfter > 0 && failures >= p.LockoutAfter {
+		return p.LockoutFor
+	}
+	over := failures - p.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < over && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
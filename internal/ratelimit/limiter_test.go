@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     10 * time.Second,
+	LockoutAfter: 10,
+	LockoutFor:   time.Hour,
+	Window:       time.Hour,
+}
+
+func TestDelay(t *testing.T) {
+	noLockout := testPolicy
+	noLockout.LockoutAfter = 0
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		failures int
+		want     time.Duration
+	}{
+		{"no failures", testPolicy, 0, 0},
+		{"last free attempt", testPolicy, 3, 0},
+		{"first delay", testPolicy, 4, time.Second},
+		{"doubles", testPolicy, 5, 2 * time.Second},
+		{"doubles again", testPolicy, 7, 8 * time.Second},
+		{"capped at max", testPolicy, 8, 10 * time.Second},
+		{"stays at max", testPolicy, 9, 10 * time.Second},
+		{"lockout", testPolicy, 10, time.Hour},
+		{"past lockout", testPolicy, 25, time.Hour},
+		{"no lockout configured", noLockout, 1000, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(NewMemoryStore(), "", tt.policy)
+			if got := l.delay(tt.failures); got != tt.want {
+				t.Errorf("delay(%d) = %v, want %v", tt.failures, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFail(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), "test:", testPolicy)
+
+	want := []time.Duration{
+		0, 0, 0,
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		10 * time.Second, 10 * time.Second,
+		time.Hour,
+	}
+	for i, expected := range want {
+		got, err := l.Fail("key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("failure %d: blocked for %v, want %v", i+1, got, expected)
+		}
+	}
+
+	wait, err := l.RetryAfter("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wait <= 59*time.Minute || wait > time.Hour {
+		t.Errorf("RetryAfter during lockout = %v, want about an hour", wait)
+	}
+
+	if wait, _ := l.RetryAfter("other"); wait != 0 {
+		t.Errorf("RetryAfter for an unrelated key = %v, want 0", wait)
+	}
+}
+
+func TestFailWindowExpires(t *testing.T) {
+	store := NewMemoryStore()
+	l := NewLimiter(store, "test:", testPolicy)
+
+	for i := 0; i < 6; i++ {
+		if _, err := l.Fail("key"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Age every failure out of the window and lift the block.
+	store.Update("test:key", func(entry *Entry) {
+		entry.LastFailure = time.Now().Add(-2 * testPolicy.Window)
+		entry.BlockedUntil = time.Time{}
+	})
+
+	got, err := l.Fail("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 0 {
+		t.Errorf("first failure after the window: blocked for %v, want 0", got)
+	}
+	if entry, _ := store.Get("test:key"); entry.Failures != 1 {
+		t.Errorf("failures after the window = %d, want 1", entry.Failures)
+	}
+}
+
+func TestReset(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), "test:", testPolicy)
+
+	for i := 0; i < 5; i++ {
+		l.Fail("key")
+	}
+	if wait, _ := l.RetryAfter("key"); wait == 0 {
+		t.Fatal("expected key to be blocked before Reset")
+	}
+
+	if err := l.Reset("key"); err != nil {
+		t.Fatal(err)
+	}
+	if wait, _ := l.RetryAfter("key"); wait != 0 {
+		t.Errorf("RetryAfter after Reset = %v, want 0", wait)
+	}
+	if got, _ := l.Fail("key"); got != 0 {
+		t.Errorf("first failure after Reset: blocked for %v, want 0", got)
+	}
+}
@@ -0,0 +1,60 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Entries idle for this long are dropped. It should exceed every policy's
+// Window and LockoutFor.
+const retention = 24 * time.Hour
+
+const pruneEvery = 1024
+
+// MemoryStore keeps entries in this process.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]Entry
+	updates int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
+
+func (s *MemoryStore) Get(key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key], nil
+}
+
+func (s *MemoryStore) Update(key string, fn func(entry *Entry)) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updates++
+	if s.updates%pruneEvery == 0 {
+		s.prune()
+	}
+
+	entry := s.entries[key]
+	fn(&entry)
+	s.entries[key] = entry
+	return entry, nil
+}
+
+func (s *MemoryStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) prune() {
+	now := time.Now()
+	for key, entry := range s.entries {
+		if now.Sub(entry.LastFailure) > retention && now.After(entry.BlockedUntil) {
+			delete(s.entries, key)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package websocket
+
+// Backend fans room broadcasts out to the other server instances and keeps
+// track of how many clients those instances have in each room.
+//
+// The Hub always delivers to its own clients directly; a Backend only has to
+// carry messages between nodes.
+type Backend interface {
+	// Start begins receiving broadcasts published by other nodes and hands
+	// each one to deliver. It must not block.
+	Start(deliver func(broadcastMsg *BroadcastMessage))
+
+	// Publish sends a broadcast to every other node. It must not block the
+	// Hub's run loop.
+	Publish(broadcastMsg *BroadcastMessage)
+
+	// SetLocalRoomPresence records which users this node has in roomID.
+	SetLocalRoomPresence(roomID string, users []UserPresence)
+
+	// RemoteRoomPresence returns the users other nodes have in roomID.
+	RemoteRoomPresence(roomID string) []UserPresence
+
+	// RemotePresence returns every user connected to other nodes, one entry
+	// per user and room.
+	RemotePresence() []UserPresence
+
+	Close() error
+}
+
+// MemoryBackend is the single-node Backend: there are no other nodes to talk to.
+type MemoryBackend struct{}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{}
+}
+
+func (b *MemoryBackend) Start(deliver func(broadcastMsg *BroadcastMessage)) {}
+
+func (b *MemoryBackend) Publish(broadcastMsg *BroadcastMessage) {}
+
+func (b *MemoryBackend) SetLocalRoomPresence(roomID string, users []UserPresence) {}
+
+func (b *MemoryBackend) RemoteRoomPresence(roomID string) []UserPresence {
+	return nil
+}
+
+func (b *MemoryBackend) RemotePresence() []UserPresence {
+	return nil
+}
+
+func (b *MemoryBackend) Close() error {
+	return nil
+}
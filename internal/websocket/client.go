@@ -1,7 +1,9 @@
 package websocket
 
 import (
+	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -12,8 +14,33 @@ const (
 	pongWait       = 60 * time.Second
 	pingPeriod     = (pongWait * 9) / 10
 	maxMessageSize = 512 * 1024
+	sendBufferSize = 256
 )
 
+// SlowConsumerPolicy decides what happens when a client's send buffer is full.
+type SlowConsumerPolicy string
+
+const (
+	// PolicyDropOldest discards the oldest queued frame to make room.
+	PolicyDropOldest SlowConsumerPolicy = "drop_oldest"
+	// PolicyDisconnect closes the connection with CloseTryAgainLater.
+	PolicyDisconnect SlowConsumerPolicy = "disconnect"
+	// PolicyCoalesceTyping keeps only the latest typing frame per sender
+	// outside the queue, and disconnects if the queue still fills up.
+	PolicyCoalesceTyping SlowConsumerPolicy = "coalesce_typing"
+)
+
+func ParseSlowConsumerPolicy(value string) (SlowConsumerPolicy, bool) {
+	switch policy := SlowConsumerPolicy(value); policy {
+	case PolicyDropOldest, PolicyDisconnect, PolicyCoalesceTyping:
+		return policy, true
+	}
+	return "", false
+}
+
+// Client is one WebSocket connection. Send is only ever closed by the client
+// itself (through close), so the Hub, handlers and the write pump can all
+// enqueue without racing on it.
 type Client struct {
 	Hub      *Hub
 	Conn     *websocket.Conn
@@ -21,6 +48,171 @@ type Client struct {
 	RoomID   string
 	UserID   uint
 	Username string
+	Roles    []string
+
+	idle bool // guarded by Hub.mu
+
+	mu        sync.Mutex
+	closed    bool
+	closeCode int
+	closeText string
+	policy    SlowConsumerPolicy
+	coalesced map[string][]byte
+	flush     chan struct{}
+	holding   bool
+	held      [][]byte
+}
+
+func NewClient(hub *Hub, conn *websocket.Conn, roomID string, userID uint, username string, roles []string) *Client {
+	return &Client{
+		Hub:       hub,
+		Conn:      conn,
+		Send:      make(chan []byte, sendBufferSize),
+		RoomID:    roomID,
+		UserID:    userID,
+		Username:  username,
+		Roles:     roles,
+		closeCode: websocket.CloseNormalClosure,
+		policy:    hub.SlowConsumer,
+		coalesced: make(map[string][]byte),
+		flush:     make(chan struct{}, 1),
+	}
+}
+
+// Enqueue queues a frame for the write pump without blocking. It reports
+// false if the frame was not queued because the client is closed or was
+// disconnected as a slow consumer.
+func (c *Client) Enqueue(message []byte) bool {
+	return c.enqueue(message, "")
+}
+
+// enqueue is Enqueue for frames that may be coalesced under key (e.g. one
+// typing indicator per sender).
+func (c *Client) enqueue(message []byte, key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return false
+	}
+
+	if key != "" && c.policy == PolicyCoalesceTyping {
+		c.coalesced[key] = message
+		select {
+		case c.flush <- struct{}{}:
+		default:
+		}
+		return true
+	}
+
+	if c.holding {
+		if len(c.held) == sendBufferSize {
+			if c.policy != PolicyDropOldest {
+				log.Printf("Disconnecting slow client %s in room %s", c.Username, c.RoomID)
+				c.closeLocked(websocket.CloseTryAgainLater, "slow consumer")
+				return false
+			}
+			c.held = c.held[1:]
+		}
+		c.held = append(c.held, message)
+		return true
+	}
+
+	return c.queueLocked(message)
+}
+
+// queueLocked puts message on Send, applying the slow consumer policy if the
+// queue is full. c.mu must be held and the client must not be closed.
+func (c *Client) queueLocked(message []byte) bool {
+	select {
+	case c.Send <- message:
+		return true
+	default:
+	}
+
+	if c.policy == PolicyDropOldest {
+		// The write pump may drain the queue concurrently, so the receive
+		// can find it empty; either way there is now room, since only
+		// callers holding c.mu send.
+		select {
+		case <-c.Send:
+		default:
+		}
+		c.Send <- message
+		return true
+	}
+
+	log.Printf("Disconnecting slow client %s in room %s", c.Username, c.RoomID)
+	c.closeLocked(websocket.CloseTryAgainLater, "slow consumer")
+	return false
+}
+
+// Hold parks live frames instead of queueing them, so history written
+// straight to the connection before the write pump starts is not overtaken by
+// them. Call it before registering the client.
+func (c *Client) Hold() {
+	c.mu.Lock()
+	c.holding = true
+	c.mu.Unlock()
+}
+
+// Release queues the frames parked since Hold, skipping new_message events
+// the replay already covered up to lastEventID.
+func (c *Client) Release(lastEventID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	held := c.held
+	c.holding, c.held = false, nil
+	for _, frame := range held {
+		if c.closed {
+			return
+		}
+		var event struct {
+			Type    string `json:"type"`
+			EventID uint   `json:"event_id"`
+		}
+		if json.Unmarshal(frame, &event) == nil && event.Type == EventTypeNewMessage && event.EventID <= lastEventID {
+			continue
+		}
+		c.queueLocked(frame)
+	}
+}
+
+// close shuts the send side down; the write pump then sends a close frame and
+// drops the connection. It is safe to call more than once.
+func (c *Client) close(code int, text string) {
+	c.mu.Lock()
+	c.closeLocked(code, text)
+	c.mu.Unlock()
+}
+
+func (c *Client) closeLocked(code int, text string) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.closeCode = code
+	c.closeText = text
+	close(c.Send)
+}
+
+func (c *Client) takeCoalesced() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	frames := make([][]byte, 0, len(c.coalesced))
+	for key, frame := range c.coalesced {
+		frames = append(frames, frame)
+		delete(c.coalesced, key)
+	}
+	return frames
+}
+
+func (c *Client) closeMessage() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return websocket.FormatCloseMessage(c.closeCode, c.closeText)
 }
 
 func (c *Client) ReadPump() {
@@ -65,7 +257,7 @@ func (c *Client) WritePump() {
 		case message, ok := <-c.Send:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				c.Conn.WriteMessage(websocket.CloseMessage, c.closeMessage())
 				return
 			}
 
@@ -73,6 +265,14 @@ func (c *Client) WritePump() {
 				return
 			}
 
+		case <-c.flush:
+			for _, frame := range c.takeCoalesced() {
+				c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := c.Conn.WriteMessage(websocket.TextMessage, frame); err != nil {
+					return
+				}
+			}
+
 		case <-ticker.C:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
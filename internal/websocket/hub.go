@@ -3,13 +3,19 @@ package websocket
 import (
 	"encoding/json"
 	"log"
+	"sort"
 	"sync"
+
+	"github.com/gorilla/websocket"
 )
 
 type BroadcastMessage struct {
 	RoomID  string
 	Message []byte
 	Sender  *Client
+	// CoalesceKey marks frames that a newer frame with the same key makes
+	// obsolete, such as typing indicators.
+	CoalesceKey string
 }
 
 type Hub struct {
@@ -21,69 +27,168 @@ type Hub struct {
 
 	Unregister chan *Client
 
+	// remote carries broadcasts published by other nodes through the backend.
+	remote chan *BroadcastMessage
+
+	status chan statusChange
+
+	// OnUserOffline, if set, is called once a user's last connection on this
+	// node closes.
+	OnUserOffline func(userID uint)
+
+	// SlowConsumer applies to clients created after it is set.
+	SlowConsumer SlowConsumerPolicy
+
+	backend Backend
+
 	mu sync.RWMutex
 }
 
 func NewHub() *Hub {
+	return NewHubWithBackend(NewMemoryBackend())
+}
+
+func NewHubWithBackend(backend Backend) *Hub {
 	return &Hub{
 		Rooms:      make(map[string]map[*Client]bool),
 		Broadcast:  make(chan *BroadcastMessage),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
+		remote:     make(chan *BroadcastMessage, 256),
+		status:     make(chan statusChange),
+		backend:    backend,
+
+		SlowConsumer: PolicyDisconnect,
 	}
 }
 
 func (h *Hub) Run() {
+	h.backend.Start(func(broadcastMsg *BroadcastMessage) {
+		h.remote <- broadcastMsg
+	})
+
 	for {
 		select {
 		case client := <-h.Register:
+			_, alreadyPresent := h.RoomPresence(client.RoomID)[client.UserID]
+
 			h.mu.Lock()
 			if h.Rooms[client.RoomID] == nil {
 				h.Rooms[client.RoomID] = make(map[*Client]bool)
 			}
 			h.Rooms[client.RoomID][client] = true
+			h.syncRoomPresence(client.RoomID)
 			h.mu.Unlock()
 
 			log.Printf("Client %s joined room %s", client.Username, client.RoomID)
 
-			h.notifyJoin(client)
+			h.sendSnapshot(client)
+			if !alreadyPresent {
+				h.notifyJoin(client)
+			}
 
 		case client := <-h.Unregister:
+			removed := false
 			h.mu.Lock()
 			if clients, ok := h.Rooms[client.RoomID]; ok {
 				if _, exists := clients[client]; exists {
 					delete(clients, client)
-					close(client.Send)
+					removed = true
 
 					if len(clients) == 0 {
 						delete(h.Rooms, client.RoomID)
 					}
+					h.syncRoomPresence(client.RoomID)
 				}
 			}
+			connected := h.userConnected(client.UserID)
 			h.mu.Unlock()
+			client.close(websocket.CloseNormalClosure, "")
+
+			if !removed {
+				continue
+			}
 
 			log.Printf("Client %s left room %s", client.Username, client.RoomID)
-			h.notifyLeave(client)
+			if _, stillPresent := h.RoomPresence(client.RoomID)[client.UserID]; !stillPresent {
+				h.notifyLeave(client)
+			}
+			if !connected && h.OnUserOffline != nil {
+				go h.OnUserOffline(client.UserID)
+			}
 
-		case broadcastMsg := <-h.Broadcast:
-			h.mu.RLock()
-			clients := h.Rooms[broadcastMsg.RoomID]
-			h.mu.RUnlock()
-
-			for client := range clients {
-				select {
-				case client.Send <- broadcastMsg.Message:
-				default:
-					h.mu.Lock()
-					delete(h.Rooms[broadcastMsg.RoomID], client)
-					close(client.Send)
-					h.mu.Unlock()
-				}
+		case change := <-h.status:
+			client := change.client
+			h.mu.Lock()
+			if !h.Rooms[client.RoomID][client] {
+				h.mu.Unlock()
+				continue
+			}
+			before := h.localRoomPresence(client.RoomID)[client.UserID]
+			client.idle = change.idle
+			after := h.localRoomPresence(client.RoomID)[client.UserID]
+			if before.Status != after.Status {
+				h.syncRoomPresence(client.RoomID)
+			}
+			h.mu.Unlock()
+
+			if before.Status != after.Status {
+				h.broadcastToRoom(client.RoomID, Event{
+					Type:    EventTypePresenceUpdated,
+					Payload: after,
+				})
 			}
+
+		case broadcastMsg := <-h.Broadcast:
+			h.deliver(broadcastMsg)
+			h.backend.Publish(broadcastMsg)
+
+		case broadcastMsg := <-h.remote:
+			h.deliver(broadcastMsg)
 		}
 	}
 }
 
+// roomClients copies a room's clients so they can be sent to without holding
+// the lock.
+func (h *Hub) roomClients(roomID string) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(h.Rooms[roomID]))
+	for client := range h.Rooms[roomID] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// deliver hands a broadcast to this node's clients in the room. Slow clients
+// are dealt with by their SlowConsumerPolicy; one the policy disconnects stays
+// registered until its read loop notices and unregisters it.
+func (h *Hub) deliver(broadcastMsg *BroadcastMessage) {
+	for _, client := range h.roomClients(broadcastMsg.RoomID) {
+		client.enqueue(broadcastMsg.Message, broadcastMsg.CoalesceKey)
+	}
+}
+
+// sendSnapshot tells a newly joined client who is already in the room.
+func (h *Hub) sendSnapshot(client *Client) {
+	users := h.RoomPresence(client.RoomID)
+	snapshot := PresenceSnapshot{
+		RoomID: client.RoomID,
+		Users:  make([]UserPresence, 0, len(users)),
+	}
+	for _, entry := range users {
+		snapshot.Users = append(snapshot.Users, entry)
+	}
+	sort.Slice(snapshot.Users, func(i, j int) bool {
+		return snapshot.Users[i].Username < snapshot.Users[j].Username
+	})
+
+	data, _ := json.Marshal(Event{Type: EventTypePresenceSnapshot, Payload: snapshot})
+	client.Enqueue(data)
+}
+
 func (h *Hub) notifyJoin(client *Client) {
 	msg := Event{
 		Type: EventTypeUserJoined,
@@ -108,20 +213,13 @@ func (h *Hub) notifyLeave(client *Client) {
 
 func (h *Hub) broadcastToRoom(roomID string, msg Event) {
 	data, _ := json.Marshal(msg)
-	h.mu.RLock()
-	clients := h.Rooms[roomID]
-	h.mu.RUnlock()
-
-	for client := range clients {
-		select {
-		case client.Send <- data:
-		default:
-		}
-	}
+	broadcastMsg := &BroadcastMessage{RoomID: roomID, Message: data}
+	h.deliver(broadcastMsg)
+	h.backend.Publish(broadcastMsg)
 }
 
+// GetRoomClients returns the number of distinct users in a room across all
+// nodes.
 func (h *Hub) GetRoomClients(roomID string) int {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	return len(h.Rooms[roomID])
+	return len(h.RoomPresence(roomID))
 }
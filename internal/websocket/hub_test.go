@@ -0,0 +1,153 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// TestHubConcurrentUse drives Register, Unregister, Broadcast and Enqueue from
+// many goroutines at once; run it with -race.
+func TestHubConcurrentUse(t *testing.T) {
+	policies := []SlowConsumerPolicy{PolicyDropOldest, PolicyDisconnect, PolicyCoalesceTyping}
+
+	for _, policy := range policies {
+		t.Run(string(policy), func(t *testing.T) {
+			const (
+				rooms      = 3
+				perRoom    = 8
+				broadcasts = 200
+			)
+
+			hub := NewHub()
+			hub.SlowConsumer = policy
+			go hub.Run()
+
+			var clients []*Client
+			for i := 0; i < rooms*perRoom; i++ {
+				room := fmt.Sprintf("room-%d", i%rooms)
+				clients = append(clients, NewClient(hub, nil, room, uint(i%5+1), fmt.Sprintf("user-%d", i), nil))
+			}
+
+			var wg sync.WaitGroup
+			for i, client := range clients {
+				// Half the clients drain their queue like a write pump, the
+				// rest never read so the slow consumer policy kicks in.
+				if i%2 == 0 {
+					wg.Add(1)
+					go func(client *Client) {
+						defer wg.Done()
+						for range client.Send {
+							client.takeCoalesced()
+						}
+					}(client)
+				}
+
+				wg.Add(1)
+				go func(client *Client) {
+					defer wg.Done()
+					hub.Register <- client
+					for j := 0; j < 50; j++ {
+						client.Enqueue([]byte("direct"))
+						client.enqueue([]byte("typing"), "typing:1")
+					}
+					hub.Unregister <- client
+					// A second unregister, as when the read loop and a
+					// handler both give up on the connection.
+					hub.Unregister <- client
+				}(client)
+			}
+
+			for i := 0; i < rooms; i++ {
+				wg.Add(1)
+				go func(room string) {
+					defer wg.Done()
+					for j := 0; j < broadcasts; j++ {
+						msg := &BroadcastMessage{RoomID: room, Message: []byte("broadcast")}
+						if j%3 == 0 {
+							msg.CoalesceKey = "typing:2"
+						}
+						hub.Broadcast <- msg
+					}
+				}(fmt.Sprintf("room-%d", i))
+			}
+
+			wg.Wait()
+
+			// The run loop handles one message at a time, so once this is
+			// received every earlier unregister has been applied.
+			hub.Broadcast <- &BroadcastMessage{RoomID: "room-0", Message: []byte("sync")}
+
+			hub.mu.RLock()
+			remaining := len(hub.Rooms)
+			hub.mu.RUnlock()
+			if remaining != 0 {
+				t.Fatalf("%d rooms still registered after every client left", remaining)
+			}
+
+			for _, client := range clients {
+				if client.Enqueue([]byte("late")) {
+					t.Fatalf("client %s accepted a frame after it was unregistered", client.Username)
+				}
+			}
+		})
+	}
+}
+
+func TestClientHoldRelease(t *testing.T) {
+	hub := NewHub()
+	client := NewClient(hub, nil, "room", 1, "user", nil)
+	client.Hold()
+
+	frame := func(event Event) []byte {
+		data, _ := json.Marshal(event)
+		return data
+	}
+	replayed := frame(Event{Type: EventTypeNewMessage, EventID: 5})
+	fresh := frame(Event{Type: EventTypeNewMessage, EventID: 6})
+	edit := frame(Event{Type: EventTypeMessageEdited})
+
+	// More live frames than the queue holds would disconnect a running client.
+	for i := 0; i < sendBufferSize; i++ {
+		if !client.Enqueue(replayed) {
+			t.Fatal("held client was disconnected")
+		}
+	}
+	client.Enqueue(fresh)
+	if client.Enqueue(edit) {
+		t.Fatal("held client over its limit was not disconnected")
+	}
+
+	client = NewClient(hub, nil, "room", 1, "user", nil)
+	client.Hold()
+	for _, f := range [][]byte{replayed, edit, fresh} {
+		client.Enqueue(f)
+	}
+	if len(client.Send) != 0 {
+		t.Fatalf("%d frames queued while held", len(client.Send))
+	}
+
+	client.Release(5)
+	var got []string
+	for len(client.Send) > 0 {
+		got = append(got, string(<-client.Send))
+	}
+	want := []string{string(edit), string(fresh)}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("released %v, want %v", got, want)
+	}
+
+	client.Enqueue(replayed)
+	if len(client.Send) != 1 {
+		t.Error("frames after Release are not queued directly")
+	}
+}
@@ -18,21 +18,47 @@ const (
 	EventTypeNewMessage = "new_message"
 	EventTypeUserJoined = "user_joined"
 	EventTypeUserLeft   = "user_left"
+
+	EventTypeReactionUpdated = "reaction_updated"
+
+	MessageTypeEditMessage   = "edit_message"
+	MessageTypeDeleteMessage = "delete_message"
+	EventTypeMessageEdited   = "message_edited"
+	EventTypeMessageDeleted  = "message_deleted"
+
+	MessageTypePresence       = "presence"
+	EventTypePresenceSnapshot = "presence_snapshot"
+	EventTypePresenceUpdated  = "presence_updated"
+
+	EventTypeAck            = "ack"
+	EventTypeReplayComplete = "replay_complete"
+
+	EventTypeGameSnapshot = "game_snapshot"
+	EventTypeMoveRejected = "move_rejected"
+	EventTypeGameOver     = "game_over"
+	EventTypeGameChat     = "game_chat"
+
+	ReactionActionAdd    = "add"
+	ReactionActionRemove = "remove"
 )
 
 type IncomingMessage struct {
-	Type      string          `json:"type"`
-	RoomID    string          `json:"room_id,omitempty"`
-	UserID    uint            `json:"user_id,omitempty"`
-	Username  string          `json:"username,omitempty"`
-	Content   string          `json:"content,omitempty"`
-	Payload   json.RawMessage `json:"payload,omitempty"`
-	Data      json.RawMessage `json:"data,omitempty"`
-	Timestamp int64           `json:"timestamp,omitempty"`
+	Type        string          `json:"type"`
+	ClientMsgID string          `json:"client_msg_id,omitempty"`
+	RoomID      string          `json:"room_id,omitempty"`
+	UserID      uint            `json:"user_id,omitempty"`
+	Username    string          `json:"username,omitempty"`
+	Content     string          `json:"content,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	Timestamp   int64           `json:"timestamp,omitempty"`
 }
 
 type Event struct {
-	Type    string      `json:"type"`
+	Type string `json:"type"`
+	// EventID is set on new_message events to the message ID; clients pass
+	// the last one they saw as ?last_event_id= when reconnecting.
+	EventID uint        `json:"event_id,omitempty"`
 	Payload interface{} `json:"payload,omitempty"`
 }
 
@@ -49,6 +75,16 @@ type GameMoveMessage struct {
 	Rotation  float64 `json:"rotation"`
 }
 
+// GameChatMessage is chat inside a game room. Players and spectators chat in
+// separate channels; Spectator says which one this came from.
+type GameChatMessage struct {
+	UserID    uint   `json:"user_id"`
+	Username  string `json:"username"`
+	Content   string `json:"content"`
+	Spectator bool   `json:"spectator"`
+	Timestamp int64  `json:"timestamp"`
+}
+
 type TypingMessage struct {
 	UserID   uint   `json:"user_id"`
 	Username string `json:"username"`
@@ -62,6 +98,58 @@ type ReactionMessage struct {
 	Action    string `json:"action"`
 }
 
+type ReactionUpdatedMessage struct {
+	MessageID   uint                `json:"message_id"`
+	UserID      uint                `json:"user_id"`
+	Username    string              `json:"username"`
+	Emoji       string              `json:"emoji"`
+	Action      string              `json:"action"`
+	EmojiCounts map[string]int      `json:"emoji_counts"`
+	EmojiUsers  map[string][]string `json:"emoji_users"`
+}
+
+type EditMessagePayload struct {
+	MessageID uint   `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+type DeleteMessagePayload struct {
+	MessageID uint `json:"message_id"`
+}
+
+type MessageDeletedMessage struct {
+	MessageID  uint   `json:"message_id"`
+	ChatroomID uint   `json:"chatroom_id"`
+	DeletedBy  uint   `json:"deleted_by"`
+	DeletedAt  string `json:"deleted_at"`
+}
+
+type PresenceMessage struct {
+	Status string `json:"status"` // online or idle
+}
+
+type ErrorMessage struct {
+	Message     string `json:"message"`
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+}
+
+// AckMessage confirms a frame sent with a client_msg_id. Duplicate is set
+// when the frame had already been processed and nothing new was saved.
+type AckMessage struct {
+	ClientMsgID string `json:"client_msg_id"`
+	MessageID   uint   `json:"message_id,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	Duplicate   bool   `json:"duplicate,omitempty"`
+}
+
+type ReplayCompleteMessage struct {
+	LastEventID uint `json:"last_event_id"`
+	Replayed    int  `json:"replayed"`
+	// Truncated means more was missed than a replay covers; the client
+	// should refetch history instead.
+	Truncated bool `json:"truncated"`
+}
+
 type OutgoingChatMessage struct {
 	ID         uint                     `json:"id"`
 	ChatroomID uint                     `json:"chatroom_id"`
@@ -69,5 +157,7 @@ type OutgoingChatMessage struct {
 	User       models.User              `json:"user"`
 	Content    string                   `json:"content"`
 	CreatedAt  string                   `json:"created_at"`
+	EditedAt   string                   `json:"edited_at,omitempty"`
 	Reactions  []models.MessageReaction `json:"reactions,omitempty"`
+	Bot        bool                     `json:"bot"` // sent by a bot account
 }
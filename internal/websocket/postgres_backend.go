@@ -0,0 +1,302 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/rj-2006/techtalk/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	hubChannel = "techtalk_hub"
+
+	// NOTIFY payloads are capped at 8000 bytes; bigger broadcasts go through
+	// the hub_messages table and only a reference is notified.
+	maxNotifyPayload = 7000
+
+	presenceInterval = 5 * time.Second
+	presenceTTL      = 30 * time.Second
+	hubMessageTTL    = time.Minute
+	outboxSize       = 1024
+)
+
+type hubEnvelope struct {
+	Node    string `json:"n"`
+	Room    string `json:"r"`
+	Message []byte `json:"m,omitempty"`
+	Ref     uint   `json:"ref,omitempty"`
+	Key     string `json:"k,omitempty"`
+}
+
+// PostgresBackend links Hubs on several server instances through Postgres
+// LISTEN/NOTIFY and a shared presence table, so no extra service is needed.
+type PostgresBackend struct {
+	db     *gorm.DB
+	dsn    string
+	nodeID string
+
+	outbox chan hubEnvelope
+
+	mu        sync.RWMutex
+	local     map[string][]UserPresence
+	remote    map[string][]UserPresence
+	remoteAll []UserPresence
+	dirty     chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewPostgresBackend uses db for publishing and presence, and opens its own
+// connection from dsn for LISTEN.
+func NewPostgresBackend(db *gorm.DB, dsn string) *PostgresBackend {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &PostgresBackend{
+		db:     db,
+		dsn:    dsn,
+		nodeID: uuid.New().String(),
+		outbox: make(chan hubEnvelope, outboxSize),
+		local:  make(map[string][]UserPresence),
+		remote: make(map[string][]UserPresence),
+		dirty:  make(chan struct{}, 1),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (b *PostgresBackend) Start(deliver func(broadcastMsg *BroadcastMessage)) {
+	b.wg.Add(3)
+	go b.listen(deliver)
+	go b.publish()
+	go b.syncPresence()
+}
+
+func (b *PostgresBackend) Publish(broadcastMsg *BroadcastMessage) {
+	envelope := hubEnvelope{
+		Node:    b.nodeID,
+		Room:    broadcastMsg.RoomID,
+		Message: broadcastMsg.Message,
+		Key:     broadcastMsg.CoalesceKey,
+	}
+	select {
+	case b.outbox <- envelope:
+	default:
+		log.Printf("Hub backend outbox full, dropping broadcast for room %s", broadcastMsg.RoomID)
+	}
+}
+
+func (b *PostgresBackend) SetLocalRoomPresence(roomID string, users []UserPresence) {
+	b.mu.Lock()
+	if len(users) == 0 {
+		delete(b.local, roomID)
+	} else {
+		b.local[roomID] = users
+	}
+	b.mu.Unlock()
+
+	select {
+	case b.dirty <- struct{}{}:
+	default:
+	}
+}
+
+func (b *PostgresBackend) RemoteRoomPresence(roomID string) []UserPresence {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.remote[roomID]
+}
+
+func (b *PostgresBackend) RemotePresence() []UserPresence {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.remoteAll
+}
+
+func (b *PostgresBackend) Close() error {
+	b.cancel()
+	b.wg.Wait()
+	return b.db.Where("node_id = ?", b.nodeID).Delete(&models.HubPresence{}).Error
+}
+
+// listen keeps a dedicated LISTEN connection open, reconnecting with backoff.
+// Broadcasts sent while disconnected are lost; clients recover them from
+// chat history.
+func (b *PostgresBackend) listen(deliver func(broadcastMsg *BroadcastMessage)) {
+	defer b.wg.Done()
+
+	backoff := time.Second
+	for b.ctx.Err() == nil {
+		err := b.listenOnce(deliver)
+		if b.ctx.Err() != nil {
+			return
+		}
+		log.Printf("Hub backend listener stopped: %v (retrying in %s)", err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-b.ctx.Done():
+			return
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+func (b *PostgresBackend) listenOnce(deliver func(broadcastMsg *BroadcastMessage)) error {
+	conn, err := pgx.Connect(b.ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(b.ctx, "LISTEN "+hubChannel); err != nil {
+		return err
+	}
+
+	for {
+		notification, err := conn.WaitForNotification(b.ctx)
+		if err != nil {
+			return err
+		}
+
+		var envelope hubEnvelope
+		if err := json.Unmarshal([]byte(notification.Payload), &envelope); err != nil {
+			log.Printf("Hub backend received invalid payload: %v", err)
+			continue
+		}
+		if envelope.Node == b.nodeID {
+			continue
+		}
+
+		if envelope.Ref != 0 {
+			var stored models.HubMessage
+			if err := b.db.First(&stored, envelope.Ref).Error; err != nil {
+				log.Printf("Hub backend failed to load message %d: %v", envelope.Ref, err)
+				continue
+			}
+			envelope.Message = stored.Payload
+		}
+
+		deliver(&BroadcastMessage{
+			RoomID:      envelope.Room,
+			Message:     envelope.Message,
+			CoalesceKey: envelope.Key,
+		})
+	}
+}
+
+func (b *PostgresBackend) publish() {
+	defer b.wg.Done()
+
+	for {
+		select {
+		case envelope := <-b.outbox:
+			payload, _ := json.Marshal(envelope)
+			if len(payload) > maxNotifyPayload {
+				stored := models.HubMessage{Payload: envelope.Message}
+				if err := b.db.Create(&stored).Error; err != nil {
+					log.Printf("Hub backend failed to store large broadcast: %v", err)
+					continue
+				}
+				payload, _ = json.Marshal(hubEnvelope{Node: envelope.Node, Room: envelope.Room, Ref: stored.ID, Key: envelope.Key})
+			}
+
+			if err := b.db.Exec("SELECT pg_notify(?, ?)", hubChannel, string(payload)).Error; err != nil {
+				log.Printf("Hub backend failed to publish: %v", err)
+			}
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// syncPresence writes this node's room presence and reads everyone else's,
+// on every change and at least every presenceInterval as a heartbeat.
+func (b *PostgresBackend) syncPresence() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.dirty:
+		case <-ticker.C:
+			b.cleanup()
+		case <-b.ctx.Done():
+			return
+		}
+
+		if err := b.writePresence(); err != nil {
+			log.Printf("Hub backend failed to write presence: %v", err)
+		}
+		if err := b.readPresence(); err != nil {
+			log.Printf("Hub backend failed to read presence: %v", err)
+		}
+	}
+}
+
+func (b *PostgresBackend) writePresence() error {
+	now := time.Now()
+
+	b.mu.RLock()
+	rows := make([]models.HubPresence, 0, len(b.local))
+	for roomID, users := range b.local {
+		for _, user := range users {
+			rows = append(rows, models.HubPresence{
+				NodeID:    b.nodeID,
+				RoomID:    roomID,
+				UserID:    user.UserID,
+				Username:  user.Username,
+				Status:    user.Status,
+				UpdatedAt: now,
+			})
+		}
+	}
+	b.mu.RUnlock()
+
+	return b.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("node_id = ?", b.nodeID).Delete(&models.HubPresence{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+}
+
+func (b *PostgresBackend) readPresence() error {
+	var rows []models.HubPresence
+	if err := b.db.Where("node_id <> ? AND updated_at > ?", b.nodeID, time.Now().Add(-presenceTTL)).
+		Find(&rows).Error; err != nil {
+		return err
+	}
+
+	remote := make(map[string][]UserPresence)
+	all := make([]UserPresence, 0, len(rows))
+	for _, row := range rows {
+		entry := UserPresence{UserID: row.UserID, Username: row.Username, Status: row.Status}
+		remote[row.RoomID] = append(remote[row.RoomID], entry)
+		all = append(all, entry)
+	}
+
+	b.mu.Lock()
+	b.remote = remote
+	b.remoteAll = all
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *PostgresBackend) cleanup() {
+	b.db.Where("updated_at < ?", time.Now().Add(-presenceTTL)).Delete(&models.HubPresence{})
+	b.db.Where("created_at < ?", time.Now().Add(-hubMessageTTL)).Delete(&models.HubMessage{})
+}
@@ -0,0 +1,127 @@
+package websocket
+
+const (
+	StatusOnline  = "online"
+	StatusIdle    = "idle"
+	StatusOffline = "offline"
+)
+
+// UserPresence is one user's status, with all of their connections collapsed
+// into a single entry.
+type UserPresence struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Status   string `json:"status"`
+}
+
+type PresenceSnapshot struct {
+	RoomID string         `json:"room_id"`
+	Users  []UserPresence `json:"users"`
+}
+
+type statusChange struct {
+	client *Client
+	idle   bool
+}
+
+// mergePresence folds entry into users; a user online anywhere is online.
+func mergePresence(users map[uint]UserPresence, entry UserPresence) {
+	current, ok := users[entry.UserID]
+	if !ok || current.Status != StatusOnline {
+		users[entry.UserID] = entry
+	}
+}
+
+// localRoomPresence collapses this node's connections in a room into one
+// entry per user. Callers must hold h.mu.
+func (h *Hub) localRoomPresence(roomID string) map[uint]UserPresence {
+	users := make(map[uint]UserPresence)
+	for client := range h.Rooms[roomID] {
+		status := StatusOnline
+		if client.idle {
+			status = StatusIdle
+		}
+		mergePresence(users, UserPresence{
+			UserID:   client.UserID,
+			Username: client.Username,
+			Status:   status,
+		})
+	}
+	return users
+}
+
+// RoomPresence returns everyone connected to a room on any node.
+func (h *Hub) RoomPresence(roomID string) map[uint]UserPresence {
+	h.mu.RLock()
+	users := h.localRoomPresence(roomID)
+	h.mu.RUnlock()
+
+	for _, entry := range h.backend.RemoteRoomPresence(roomID) {
+		mergePresence(users, entry)
+	}
+	return users
+}
+
+// UserStatuses returns the global status of each requested user; users with
+// no connection on any node are offline.
+func (h *Hub) UserStatuses(userIDs []uint) map[uint]string {
+	wanted := make(map[uint]bool, len(userIDs))
+	for _, id := range userIDs {
+		wanted[id] = true
+	}
+
+	users := make(map[uint]UserPresence)
+	h.mu.RLock()
+	for roomID := range h.Rooms {
+		for id, entry := range h.localRoomPresence(roomID) {
+			if wanted[id] {
+				mergePresence(users, entry)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	for _, entry := range h.backend.RemotePresence() {
+		if wanted[entry.UserID] {
+			mergePresence(users, entry)
+		}
+	}
+
+	statuses := make(map[uint]string, len(userIDs))
+	for _, id := range userIDs {
+		statuses[id] = StatusOffline
+		if entry, ok := users[id]; ok {
+			statuses[id] = entry.Status
+		}
+	}
+	return statuses
+}
+
+// SetIdle records that a client went idle or became active again.
+func (h *Hub) SetIdle(client *Client, idle bool) {
+	h.status <- statusChange{client: client, idle: idle}
+}
+
+// userConnected reports whether the user still has any connection on this
+// node. Callers must hold h.mu.
+func (h *Hub) userConnected(userID uint) bool {
+	for _, clients := range h.Rooms {
+		for client := range clients {
+			if client.UserID == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// syncRoomPresence pushes this node's view of a room to the backend. Callers
+// must hold h.mu.
+func (h *Hub) syncRoomPresence(roomID string) {
+	users := h.localRoomPresence(roomID)
+	entries := make([]UserPresence, 0, len(users))
+	for _, entry := range users {
+		entries = append(entries, entry)
+	}
+	h.backend.SetLocalRoomPresence(roomID, entries)
+}